@@ -67,7 +67,7 @@ func run() (err error) {
 	})
 
 	h := server.NewHandlers(db)
-	srv := server.InitServer(h)
+	srv := server.InitServer(h, cfg.AccessLog)
 
 	// запуск сервера
 	g.Go(func() (err error) {
@@ -3,12 +3,14 @@ package config
 import "flag"
 
 type Config struct {
-	DSN string
+	DSN       string
+	AccessLog bool
 }
 
 func GetConfig() *Config {
 	c := &Config{}
 	flag.StringVar(&c.DSN, "dsn", "", "connection string")
+	flag.BoolVar(&c.AccessLog, "access-log", false, "log every request, the log can be replayed by loadgen")
 
 	flag.Parse()
 
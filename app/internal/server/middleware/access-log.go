@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+// AccessLog logs every request in a line which can be replayed with "loadgen replay":
+//
+//	access ts=2024-05-01T10:00:00.123456Z method=GET path=/employee-by-email/... status=200 duration=1.2ms size=120
+//
+// ts is the moment the request has been received, size is the length of the response body.
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		log.Printf(
+			"access ts=%s method=%s path=%s status=%d duration=%v size=%d",
+			start.UTC().Format(time.RFC3339Nano), r.Method, r.URL.RequestURI(), rec.status, time.Since(start), rec.size,
+		)
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	size        int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status = code
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.size += n
+	return n, err
+}
@@ -10,10 +10,16 @@ import (
 	"github.com/julienschmidt/httprouter"
 )
 
-func InitServer(h *Handlers) *http.Server {
+// InitServer returns the server of the handlers. The access log costs a log line per request,
+// so it is only enabled on demand not to change the performance of the service under load.
+func InitServer(h *Handlers, accessLog bool) *http.Server {
+	handler := initRouter(h)
+	if accessLog {
+		handler = middleware.AccessLog(handler)
+	}
 	return &http.Server{
 		Addr:    ":8080",
-		Handler: initRouter(h),
+		Handler: handler,
 	}
 }
 
@@ -17,6 +17,8 @@ func GetConfig() (Config, error) {
 
 	flag.StringVar(&c.Generator.DSN, "d", "", "dsn")
 	flag.IntVar(&c.EmployeesCount, "n", 1000, "employees count")
+	flag.Int64Var(&c.Generator.Seed, "seed", 0, "seed of the generated data, 0 means a random seed")
+	flag.StringVar(&c.Generator.EmailsFile, "emails-out", "", "write the emails of the generated employees to the file")
 	flag.Parse()
 
 	if c.EmployeesCount <= 0 {
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"loadgen/internal/report"
+)
+
+var errRegressions = errors.New("regressions found")
+
+// runCompare implements the "loadgen compare old.json new.json" subcommand.
+func runCompare(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s compare [flags] old.json new.json\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	opts := report.CompareOptions{}
+	fs.Float64Var(&opts.Tolerance, "tolerance", 0.05, "relative change below which differences are ignored")
+	fs.Float64Var(&opts.Alpha, "alpha", 0.05, "significance level of the statistical tests")
+	fs.Float64Var(
+		&opts.UntestedTolerance, "untested-tolerance", 0,
+		"relative change above which the metrics without a significance test (throughput, percentiles) "+
+			"are regressions, 0 never treats them as such",
+	)
+	_ = fs.Parse(args)
+	if opts.UntestedTolerance < 0 {
+		return fmt.Errorf("untested tolerance should not be negative, got %v", opts.UntestedTolerance)
+	}
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("expected two report files")
+	}
+	oldRep, err := report.ReadJSON(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	newRep, err := report.ReadJSON(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	deltas := report.Compare(oldRep, newRep, opts)
+	if err := report.PrintComparison(os.Stdout, deltas); err != nil {
+		return fmt.Errorf("failed to print the comparison: %w", err)
+	}
+	if report.HasRegressions(deltas) {
+		return errRegressions
+	}
+	return nil
+}
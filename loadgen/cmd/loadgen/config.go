@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"net/url"
 	"time"
 
 	"loadgen/internal/loadgen"
@@ -12,16 +13,355 @@ type Config struct {
 	Generator loadgen.Config
 }
 
-func GetConfig() (Config, error) {
+func GetConfig(args []string) (Config, error) {
 	c := Config{}
 
 	flag.DurationVar(&c.Generator.Duration, "dur", time.Second*5, "load testing duration")
+	flag.DurationVar(
+		&c.Generator.Warmup, "warmup", 0, "load generated before -dur which is not included into the results",
+	)
 	flag.IntVar(&c.Generator.WorkersCount, "workers", 10, "number of workers")
-	flag.Parse()
+	flag.Int64Var(&c.Generator.Seed, "seed", 0, "seed of the random sequences to reproduce a run, 0 means a random seed")
+	flag.StringVar(
+		&c.Generator.Impl, "impl", loadgen.ImplDispatcher,
+		fmt.Sprintf("generator implementation: %s|%s", loadgen.ImplDispatcher, loadgen.ImplNominal),
+	)
+	flag.IntVar(
+		&c.Generator.Rate, "rate", 0,
+		"constant arrival rate (requests per second) served by the pool of workers, 0 means closed-model generation",
+	)
+	var stages string
+	flag.StringVar(
+		&stages, "stages", "",
+		`load profile as comma-separated "duration:[from-]to" stages, e.g. "30s:1-50,2m:50,10s:200-200,30s:0"`,
+	)
+	flag.StringVar(
+		&c.Generator.StagesTarget, "stages-target", loadgen.StageTargetWorkers,
+		fmt.Sprintf("what the stage targets mean: %s|%s", loadgen.StageTargetWorkers, loadgen.StageTargetRate),
+	)
+	thinkTime := flag.String(
+		"think-time", "",
+		`pause of every worker after a request: "fixed:100ms", "uniform:50ms-150ms" or "exp:100ms"`,
+	)
+	flag.DurationVar(
+		&c.Generator.Pacing, "pacing", 0, "every worker starts one request per interval, 0 means no pacing",
+	)
+	flag.StringVar(
+		&c.Generator.Driver, "driver", loadgen.DriverHTTP,
+		fmt.Sprintf(
+			"how the lookups are performed: %s|%s (queries Postgres directly to measure the HTTP overhead)",
+			loadgen.DriverHTTP, loadgen.DriverPgx,
+		),
+	)
+	flag.StringVar(&c.Generator.DriverDSN, "driver-dsn", "", "DSN of the DB queried by the pgx driver")
+	workload := flag.String("workload", "reads=1", `weighted mix of operations, e.g. "reads=90,writes=10"`)
+	verify := flag.Bool(
+		"verify", false,
+		"check that the found employees are well-formed and have the requested email, mismatches are errors",
+	)
+	scenario := flag.String(
+		"scenario", "",
+		"JSON scenario file, its settings override the flags and the requests replace the -workload",
+	)
+	flag.DurationVar(
+		&c.Generator.ProgressInterval, "progress", time.Second, "how often to print the live statistics, 0 disables them",
+	)
+	flag.StringVar(
+		&c.Generator.MetricsAddr, "metrics-addr", "",
+		`serve the live metrics in the Prometheus text format on the address, e.g. ":9100"`,
+	)
+	flag.IntVar(
+		&c.Generator.ErrorLogRate, "error-log-rate", 10, "max individual errors logged per second, 0 disables the logging",
+	)
+	k := &c.Generator.Keys
+	flag.StringVar(&k.KnownEmailsFile, "known-emails", "", "file with existing emails, one per line (see datagen -emails-out)")
+	flag.StringVar(&k.KnownEmailsDSN, "known-emails-dsn", "", "sample the existing emails from the DB with the given DSN")
+	flag.IntVar(&k.KnownEmailsLimit, "known-emails-limit", 10000, "max number of emails sampled from the DB")
+	flag.Float64Var(
+		&k.HitRatio, "hit-ratio", 1,
+		"share of the lookups using a known email, the rest are guaranteed 404s; requires the known emails",
+	)
+	keyDist := flag.String(
+		"key-dist", "",
+		`distribution of the looked up emails: uniform|zipfian[:skew]|hotspot:traffic%/keys%|sequential, `+
+			`e.g. "hotspot:90/10"; by default every lookup uses a fresh random name`,
+	)
+	flag.IntVar(&k.KeySpace, "key-space", 10000, "number of random-name emails the -key-dist is applied to without known emails")
+	flag.Func(
+		"threshold", `pass/fail criteria, e.g. "p99<50ms,error_rate<0.1%,rps>2000" or "reads:p95<=20ms", can be repeated`,
+		func(s string) error {
+			ts, err := loadgen.ParseThresholds(s)
+			if err != nil {
+				return err
+			}
+			c.Generator.Thresholds = append(c.Generator.Thresholds, ts...)
+			return nil
+		},
+	)
+	flag.BoolVar(
+		&c.Generator.AbortOnFail, "abort-on-fail", false, "stop the test as soon as a threshold cannot pass anymore",
+	)
+	flag.StringVar(&c.Generator.Report.JSONPath, "report-json", "", "write the JSON report to the file")
+	flag.StringVar(&c.Generator.Report.CSVPath, "report-csv", "", "write the CSV report to the file")
+
+	fm := &c.Generator.FindMax
+	flag.BoolVar(&fm.Enabled, "find-max", false, "increase the load in steps until the objectives are breached")
+	flag.StringVar(
+		&fm.Target, "find-max-target", loadgen.StageTargetWorkers,
+		fmt.Sprintf("what is increased: %s|%s", loadgen.StageTargetWorkers, loadgen.StageTargetRate),
+	)
+	flag.IntVar(&fm.Start, "find-max-start", 10, "initial number of workers or rate")
+	flag.IntVar(&fm.Step, "find-max-step", 10, "increment of the number of workers or rate")
+	flag.IntVar(&fm.Limit, "find-max-limit", 1000, "max number of workers or rate")
+	flag.DurationVar(&fm.StepDuration, "find-max-step-dur", time.Second*30, "duration of every step")
+	flag.DurationVar(&fm.MaxP99, "slo-p99", 0, "p99 latency objective of the search, 0 means none")
+	flag.Float64Var(&fm.MaxErrorRate, "slo-error-rate", 0.01, "error rate objective of the search")
+	flag.StringVar(&fm.CSVPath, "find-max-csv", "", "write the scalability curve to the CSV file instead of stdout")
+
+	h := &c.Generator.HTTP
+	registerHTTPFlags(flag.CommandLine, h)
+	_ = flag.CommandLine.Parse(args)
 
 	if c.Generator.WorkersCount <= 0 {
 		return c, fmt.Errorf("workers count should be greater than 0, got %d", c.Generator.WorkersCount)
 	}
 
+	switch c.Generator.Impl {
+	case loadgen.ImplDispatcher, loadgen.ImplNominal:
+	default:
+		return c, fmt.Errorf("unknown generator implementation: %q", c.Generator.Impl)
+	}
+
+	if c.Generator.Rate < 0 {
+		return c, fmt.Errorf("rate should not be negative, got %d", c.Generator.Rate)
+	}
+
+	var err error
+	if *thinkTime != "" {
+		if c.Generator.ThinkTime, err = loadgen.ParseThinkTime(*thinkTime); err != nil {
+			return c, fmt.Errorf("invalid think time: %w", err)
+		}
+	}
+	if c.Generator.Pacing < 0 {
+		return c, fmt.Errorf("pacing should not be negative, got %v", c.Generator.Pacing)
+	}
+	if stages != "" {
+		if c.Generator.Stages, err = loadgen.ParseStages(stages); err != nil {
+			return c, fmt.Errorf("failed to parse the load profile: %w", err)
+		}
+	}
+
+	w, err := loadgen.ParseWorkload(*workload)
+	if err != nil {
+		return c, fmt.Errorf("failed to parse the workload: %w", err)
+	}
+	if c.Generator.Impl == loadgen.ImplNominal && !loadgen.IsReadOnlyWorkload(w) {
+		return c, fmt.Errorf("the %s implementation supports lookups only", loadgen.ImplNominal)
+	}
+	// the flags are a shorthand for the built-in scenario
+	c.Generator.Requests = loadgen.DefaultRequests(w, *h)
+	if *verify {
+		if c.Generator.Impl == loadgen.ImplNominal {
+			return c, fmt.Errorf("verification is not supported by the %s implementation", loadgen.ImplNominal)
+		}
+		for i := range c.Generator.Requests {
+			if c.Generator.Requests[i].Name == loadgen.OpReads {
+				c.Generator.Requests[i].Verify = loadgen.VerifyEmployee
+			}
+		}
+	}
+
+	if *scenario != "" {
+		if c.Generator.Impl == loadgen.ImplNominal {
+			return c, fmt.Errorf("scenarios are not supported by the %s implementation", loadgen.ImplNominal)
+		}
+		if err := loadgen.ApplyScenario(*scenario, &c.Generator); err != nil {
+			return c, fmt.Errorf("invalid scenario: %w", err)
+		}
+	}
+
+	if err := validateDriver(c.Generator, w, *verify, *scenario != ""); err != nil {
+		return c, err
+	}
+	if len(c.Generator.Stages) > 0 {
+		if err := validateStages(c.Generator); err != nil {
+			return c, err
+		}
+	}
+	if c.Generator.ThinkTime.Dist != "" || c.Generator.Pacing > 0 {
+		g := c.Generator
+		if g.Rate > 0 || g.Impl == loadgen.ImplNominal || (len(g.Stages) > 0 && g.StagesTarget == loadgen.StageTargetRate) {
+			return c, fmt.Errorf("think time and pacing only apply to the closed-model %s workers", loadgen.ImplDispatcher)
+		}
+	}
+	if c.Generator.Warmup < 0 {
+		return c, fmt.Errorf("warmup should not be negative, got %v", c.Generator.Warmup)
+	}
+	if c.Generator.Warmup > 0 && len(c.Generator.Stages) > 0 {
+		return c, fmt.Errorf("warmup is not supported with load profiles, add a stage instead")
+	}
+
+	if *keyDist != "" {
+		if k.Distribution, err = loadgen.ParseKeyDistribution(*keyDist); err != nil {
+			return c, fmt.Errorf("failed to parse the key distribution: %w", err)
+		}
+	}
+	if err := validateKeys(c.Generator); err != nil {
+		return c, err
+	}
+	if fm.Enabled {
+		if err := validateFindMax(c.Generator); err != nil {
+			return c, err
+		}
+	}
+	if c.Generator.ErrorLogRate < 0 {
+		return c, fmt.Errorf("error log rate should not be negative, got %d", c.Generator.ErrorLogRate)
+	}
+	if err := validateHTTP(*h); err != nil {
+		return c, err
+	}
+
 	return c, nil
 }
+
+func registerHTTPFlags(fs *flag.FlagSet, h *loadgen.HTTPConfig) {
+	fs.StringVar(&h.TargetURL, "target", "http://localhost:8080", "base URL of the service under test")
+	fs.StringVar(&h.EmailEndpoint, "email-endpoint", "/employee-by-email/", "path of the employee-by-email endpoint")
+	fs.StringVar(&h.EmployeeEndpoint, "employee-endpoint", "/employee", "path of the employee creation endpoint")
+	fs.StringVar(&h.UnixSocket, "unix-socket", "", "dial the given unix socket instead of the target host")
+	fs.DurationVar(
+		&h.Timeout, "timeout", time.Second*5, "per-request timeout (also of the pgx queries), 0 means no timeout",
+	)
+	fs.IntVar(&h.MaxIdleConns, "max-idle-conns", 0, "max idle connections in the pool, 0 means the number of workers")
+	fs.IntVar(
+		&h.MaxIdleConnsPerHost, "max-idle-conns-per-host", 0,
+		"max idle connections per host, 0 means the number of workers",
+	)
+	fs.IntVar(&h.MaxConnsPerHost, "max-conns-per-host", 0, "max connections per host, 0 means no limit")
+	fs.BoolVar(&h.DisableKeepAlives, "disable-keep-alives", false, "open a new connection for every request")
+	fs.BoolVar(&h.TLS.InsecureSkipVerify, "tls-insecure", false, "skip the server certificate verification")
+	fs.StringVar(&h.TLS.ServerName, "tls-server-name", "", "server name used to verify the server certificate")
+	fs.StringVar(&h.TLS.CAFile, "tls-ca", "", "PEM file with the CA certificates")
+	fs.StringVar(&h.TLS.CertFile, "tls-cert", "", "PEM file with the client certificate")
+	fs.StringVar(&h.TLS.KeyFile, "tls-key", "", "PEM file with the client key")
+}
+
+func validateHTTP(h loadgen.HTTPConfig) error {
+	if err := validateTargetURL(h.TargetURL); err != nil {
+		return err
+	}
+	if h.Timeout < 0 {
+		return fmt.Errorf("timeout should not be negative, got %v", h.Timeout)
+	}
+	if h.MaxIdleConns < 0 || h.MaxIdleConnsPerHost < 0 || h.MaxConnsPerHost < 0 {
+		return fmt.Errorf("connection pool sizes should not be negative")
+	}
+	return nil
+}
+
+func validateTargetURL(target string) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("failed to parse the target URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("target URL scheme should be http or https, got %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("target URL should contain a host, got %q", target)
+	}
+	return nil
+}
+
+func validateDriver(c loadgen.Config, w []loadgen.OpWeight, verify, scenario bool) error {
+	switch c.Driver {
+	case loadgen.DriverHTTP:
+		return nil
+	case loadgen.DriverPgx:
+	default:
+		return fmt.Errorf("unknown driver: %q", c.Driver)
+	}
+	if c.DriverDSN == "" {
+		return fmt.Errorf("the %s driver requires -driver-dsn", c.Driver)
+	}
+	if !loadgen.IsReadOnlyWorkload(w) || scenario {
+		return fmt.Errorf("the %s driver supports lookups only", c.Driver)
+	}
+	if verify {
+		return fmt.Errorf("verification is not supported by the %s driver", c.Driver)
+	}
+	return nil
+}
+
+func validateStages(c loadgen.Config) error {
+	switch c.StagesTarget {
+	case loadgen.StageTargetWorkers:
+		if c.Impl == loadgen.ImplNominal {
+			return fmt.Errorf("load profiles are not supported by the %s implementation", loadgen.ImplNominal)
+		}
+		if c.Rate > 0 {
+			return fmt.Errorf("worker stages cannot be combined with a fixed rate, use -stages-target=%s", loadgen.StageTargetRate)
+		}
+	case loadgen.StageTargetRate:
+		if c.Rate > 0 {
+			return fmt.Errorf("rate stages cannot be combined with a fixed rate")
+		}
+	default:
+		return fmt.Errorf("unknown stages target: %q", c.StagesTarget)
+	}
+	return nil
+}
+
+func validateKeys(c loadgen.Config) error {
+	k := c.Keys
+	if k.HitRatio < 0 || k.HitRatio > 1 {
+		return fmt.Errorf("hit ratio should be between 0 and 1, got %v", k.HitRatio)
+	}
+	if k.KnownEmailsFile == "" && k.KnownEmailsDSN == "" {
+		if k.HitRatio != 1 {
+			return fmt.Errorf("hit ratio requires -known-emails or -known-emails-dsn")
+		}
+		if k.Distribution.Kind == "" {
+			return nil
+		}
+		if k.KeySpace <= 0 {
+			return fmt.Errorf("key space should be greater than 0, got %d", k.KeySpace)
+		}
+	}
+	if k.KnownEmailsFile != "" && k.KnownEmailsDSN != "" {
+		return fmt.Errorf("-known-emails and -known-emails-dsn are mutually exclusive")
+	}
+	if k.KnownEmailsLimit <= 0 {
+		return fmt.Errorf("known emails limit should be greater than 0, got %d", k.KnownEmailsLimit)
+	}
+	if c.Impl == loadgen.ImplNominal {
+		return fmt.Errorf("key selection settings are not supported by the %s implementation", loadgen.ImplNominal)
+	}
+	return nil
+}
+
+func validateFindMax(c loadgen.Config) error {
+	fm := c.FindMax
+	switch fm.Target {
+	case loadgen.StageTargetWorkers:
+	case loadgen.StageTargetRate:
+		if c.Impl == loadgen.ImplNominal {
+			return fmt.Errorf("the rate search is not supported by the %s implementation", loadgen.ImplNominal)
+		}
+	default:
+		return fmt.Errorf("unknown find max target: %q", fm.Target)
+	}
+	if len(c.Stages) > 0 || c.Rate > 0 {
+		return fmt.Errorf("find max cannot be combined with a load profile or a fixed rate")
+	}
+	if fm.Start <= 0 || fm.Step <= 0 || fm.Limit < fm.Start {
+		return fmt.Errorf("find max start and step should be greater than 0 and the limit not less than the start")
+	}
+	if fm.StepDuration <= 0 {
+		return fmt.Errorf("find max step duration should be greater than 0, got %v", fm.StepDuration)
+	}
+	if fm.MaxP99 < 0 || fm.MaxErrorRate < 0 || fm.MaxErrorRate > 1 {
+		return fmt.Errorf("objectives should not be negative and the error rate should not exceed 1")
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"loadgen/internal/loadgen"
+)
+
+// tokenEnv is the environment variable with the shared secret, so that it does not show up in the process list.
+const tokenEnv = "LOADGEN_TOKEN"
+
+// runCoordinator implements the "loadgen coordinator [flags]" subcommand. Along with its own flags
+// it accepts the regular ones, they describe the test which is split between the agents.
+func runCoordinator(ctx context.Context, args []string) error {
+	cc := loadgen.CoordinatorConfig{}
+	flag.StringVar(&cc.Listen, "listen", "localhost:7070", "address the agents register on")
+	flag.IntVar(&cc.Agents, "agents", 2, "number of agents the test is split between")
+	flag.DurationVar(
+		&cc.StartDelay, "start-delay", time.Second*3, "delay between the last agent registration and the test start",
+	)
+	flag.StringVar(&cc.Token, "token", os.Getenv(tokenEnv), "shared secret of the agents, $"+tokenEnv+" by default")
+	cfg, err := GetConfig(args)
+	if err != nil {
+		return fmt.Errorf("failed to get config: %w", err)
+	}
+	if err := validateCoordinator(cfg.Generator, cc); err != nil {
+		return err
+	}
+
+	if err := loadgen.Coordinate(ctx, cfg.Generator, cc); err != nil {
+		return fmt.Errorf("distributed load generation has failed: %w", err)
+	}
+	return nil
+}
+
+func validateCoordinator(c loadgen.Config, cc loadgen.CoordinatorConfig) error {
+	if cc.Agents <= 0 {
+		return fmt.Errorf("agents count should be greater than 0, got %d", cc.Agents)
+	}
+	if cc.StartDelay < 0 {
+		return fmt.Errorf("start delay should not be negative, got %v", cc.StartDelay)
+	}
+	if c.WorkersCount < cc.Agents {
+		return fmt.Errorf("workers count should not be less than the agents count, got %d", c.WorkersCount)
+	}
+	if c.Rate > 0 && c.Rate < cc.Agents {
+		return fmt.Errorf("rate should not be less than the agents count, got %d", c.Rate)
+	}
+	if c.FindMax.Enabled {
+		return fmt.Errorf("find max is not supported in the distributed mode")
+	}
+	if c.AbortOnFail {
+		return fmt.Errorf("abort on fail is not supported in the distributed mode")
+	}
+	return nil
+}
+
+// runAgent implements the "loadgen agent [flags]" subcommand.
+func runAgent(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("agent", flag.ExitOnError)
+	ac := loadgen.AgentConfig{}
+	fs.StringVar(&ac.CoordinatorURL, "coordinator", "http://localhost:7070", "base URL of the coordinator")
+	hostname, _ := os.Hostname()
+	fs.StringVar(
+		&ac.Name, "name", fmt.Sprintf("%s-%d", hostname, os.Getpid()), "name of the agent in the coordinator logs",
+	)
+	fs.StringVar(&ac.Token, "token", os.Getenv(tokenEnv), "shared secret of the coordinator, $"+tokenEnv+" by default")
+	_ = fs.Parse(args)
+	if err := validateTargetURL(ac.CoordinatorURL); err != nil {
+		return fmt.Errorf("invalid coordinator URL: %w", err)
+	}
+
+	if err := loadgen.RunAgent(ctx, ac); err != nil {
+		return fmt.Errorf("agent has failed: %w", err)
+	}
+	return nil
+}
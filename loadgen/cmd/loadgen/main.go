@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"loadgen/internal/loadgen"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
@@ -14,9 +17,28 @@ func main() {
 }
 
 func run() error {
-	ctx, cancelCtx := context.WithCancel(context.Background())
+	var cmd string
+	if len(os.Args) > 1 {
+		cmd = os.Args[1]
+	}
+	if cmd == "compare" {
+		return runCompare(os.Args[2:])
+	}
+
+	ctx, cancelCtx := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancelCtx()
-	cfg, err := GetConfig()
+	// the first signal stops the test gracefully, the second one kills the process
+	context.AfterFunc(ctx, cancelCtx)
+	switch cmd {
+	case "coordinator":
+		return runCoordinator(ctx, os.Args[2:])
+	case "agent":
+		return runAgent(ctx, os.Args[2:])
+	case "replay":
+		return runReplay(ctx, os.Args[2:])
+	}
+
+	cfg, err := GetConfig(os.Args[1:])
 	if err != nil {
 		return fmt.Errorf("failed to get config: %w", err)
 	}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"loadgen/internal/loadgen"
+)
+
+// runReplay implements the "loadgen replay -log access.log" subcommand.
+func runReplay(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s replay -log access.log [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	rc := loadgen.ReplayConfig{}
+	fs.StringVar(&rc.LogFile, "log", "", "request log to replay")
+	fs.StringVar(
+		&rc.Format, "format", loadgen.ReplayFormatAuto,
+		fmt.Sprintf(
+			"log format: %s|%s|%s (the app access log or NDJSON with timestamp, method, path and body)",
+			loadgen.ReplayFormatAuto, loadgen.ReplayFormatAccess, loadgen.ReplayFormatNDJSON,
+		),
+	)
+	fs.Float64Var(
+		&rc.Speed, "speed", 1,
+		"pace multiplier: 1 preserves the logged timing, 2 is twice as fast, 0 sends the requests without pauses",
+	)
+	fs.IntVar(&rc.MaxInFlight, "max-in-flight", 100, "max concurrent requests")
+	fs.DurationVar(&rc.ProgressInterval, "progress", time.Second, "how often to print the live statistics, 0 disables them")
+	registerHTTPFlags(fs, &rc.HTTP)
+	_ = fs.Parse(args)
+
+	if rc.LogFile == "" {
+		fs.Usage()
+		return errors.New("expected the -log file")
+	}
+	switch rc.Format {
+	case loadgen.ReplayFormatAuto, loadgen.ReplayFormatAccess, loadgen.ReplayFormatNDJSON:
+	default:
+		return fmt.Errorf("unknown log format: %q", rc.Format)
+	}
+	if rc.Speed < 0 {
+		return fmt.Errorf("speed should not be negative, got %v", rc.Speed)
+	}
+	if rc.MaxInFlight <= 0 {
+		return fmt.Errorf("max in-flight requests should be greater than 0, got %d", rc.MaxInFlight)
+	}
+	if err := validateHTTP(rc.HTTP); err != nil {
+		return err
+	}
+
+	if err := loadgen.Replay(ctx, rc); err != nil {
+		return fmt.Errorf("replay has failed: %w", err)
+	}
+	return nil
+}
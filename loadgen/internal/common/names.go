@@ -22,31 +22,42 @@ type NamesFetcher struct {
 	r          *rand.Rand
 }
 
-var namesFetcher *NamesFetcher
+var (
+	namesOnce  sync.Once
+	firstNames []string
+	lastNames  []string
+	namesErr   error
+)
 
-func NewNamesFetcher() (*NamesFetcher, error) {
-	var err error
-	if namesFetcher == nil {
-		namesFetcher, err = newNamesFetcher()
-		if err != nil {
-			return nil, err
+func loadNames() ([]string, []string, error) {
+	namesOnce.Do(func() {
+		if err := json.Unmarshal(firstNamesContents, &firstNames); err != nil {
+			namesErr = fmt.Errorf("failed to unmarshal first names file: %w", err)
+			return
 		}
-	}
-	return namesFetcher, nil
+		if err := json.Unmarshal(lastNamesContents, &lastNames); err != nil {
+			namesErr = fmt.Errorf("failed to unmarshal last names file: %w", err)
+		}
+	})
+	return firstNames, lastNames, namesErr
 }
 
-func newNamesFetcher() (*NamesFetcher, error) {
-	f := &NamesFetcher{
-		r:   rand.New(rand.NewSource(time.Now().Unix())),
-		mux: &sync.Mutex{},
-	}
-	if err := json.Unmarshal(firstNamesContents, &f.firstNames); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal first names file: %w", err)
+// NewNamesFetcher returns a fetcher producing the sequence of names determined by the seed.
+// A zero seed means a random sequence.
+func NewNamesFetcher(seed int64) (*NamesFetcher, error) {
+	first, last, err := loadNames()
+	if err != nil {
+		return nil, err
 	}
-	if err := json.Unmarshal(lastNamesContents, &f.lastNames); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal last names file: %w", err)
+	if seed == 0 {
+		seed = time.Now().UnixNano()
 	}
-	return f, nil
+	return &NamesFetcher{
+		firstNames: first,
+		lastNames:  last,
+		r:          rand.New(rand.NewSource(seed)),
+		mux:        &sync.Mutex{},
+	}, nil
 }
 
 type Name struct {
@@ -2,4 +2,8 @@ package datagen
 
 type Config struct {
 	DSN string
+	// EmailsFile, if set, receives the emails of the stored employees, one per line.
+	EmailsFile string
+	// Seed determines the generated names and salaries, zero means a random seed.
+	Seed int64
 }
@@ -0,0 +1,53 @@
+package datagen
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// emailsWriter saves the emails of the stored employees so that loadgen can look them up.
+type emailsWriter struct {
+	mux    *sync.Mutex
+	f      *os.File
+	w      *bufio.Writer
+	closed bool
+}
+
+func newEmailsWriter(path string) (*emailsWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the emails file: %w", err)
+	}
+	return &emailsWriter{
+		mux: &sync.Mutex{},
+		f:   f,
+		w:   bufio.NewWriter(f),
+	}, nil
+}
+
+func (w *emailsWriter) write(emps []Employee) error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	for _, e := range emps {
+		if _, err := fmt.Fprintln(w.w, e.Email); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *emailsWriter) close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if err := w.w.Flush(); err != nil {
+		_ = w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
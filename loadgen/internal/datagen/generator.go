@@ -7,6 +7,7 @@ import (
 	"log"
 	"math/rand"
 	"sync"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -15,7 +16,14 @@ import (
 )
 
 type Generator struct {
-	db *pgxpool.Pool
+	db         *pgxpool.Pool
+	emailsFile string
+	emails     *emailsWriter
+	seed       int64
+	// rowsMux makes the names and the salaries come from the seeded sequences in the same order,
+	// so that the set of the generated employees does not depend on the workers scheduling.
+	rowsMux *sync.Mutex
+	rnd     *rand.Rand
 }
 
 const maxConns = 10
@@ -24,7 +32,17 @@ func NewGenerator(ctx context.Context, cfg *Config) (*Generator, error) {
 	if cfg == nil {
 		return nil, errors.New("passed configuration is nil")
 	}
-	gen := &Generator{}
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	log.Printf("seed: %d", seed)
+	gen := &Generator{
+		emailsFile: cfg.EmailsFile,
+		seed:       seed,
+		rowsMux:    &sync.Mutex{},
+		rnd:        rand.New(rand.NewSource(seed)),
+	}
 	connCfg, err := pgxpool.ParseConfig(cfg.DSN)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse the DSN: %w", err)
@@ -42,9 +60,20 @@ func (g *Generator) GenerateData(ctx context.Context, employeesCount int) error
 	if err != nil {
 		return fmt.Errorf("failed to generate employees positions: %w", err)
 	}
+	if g.emailsFile != "" {
+		if g.emails, err = newEmailsWriter(g.emailsFile); err != nil {
+			return err
+		}
+		defer g.emails.close()
+	}
 	if err := g.generateEmployees(ctx, employeesCount, positions); err != nil {
 		return fmt.Errorf("failed to generate employees: %w", err)
 	}
+	if g.emails != nil {
+		if err := g.emails.close(); err != nil {
+			return fmt.Errorf("failed to write the emails file: %w", err)
+		}
+	}
 	return nil
 }
 
@@ -106,7 +135,7 @@ func (g *Generator) generateEmployees(ctx context.Context, employeesCount int, p
 	workersCount := maxConns
 	tasks := make(chan int, workersCount)
 	results := make(chan workerResult, workersCount)
-	f, err := common.NewNamesFetcher()
+	f, err := common.NewNamesFetcher(g.seed)
 	if err != nil {
 		return fmt.Errorf("failed to get a new names fetcher: %w", err)
 	}
@@ -203,15 +232,22 @@ func (g *Generator) workerPayload(
 	positions []int,
 ) error {
 	names := make([]common.Name, employeesCount)
-	f.GetNames(names)
 	emps := make([]Employee, len(names))
+	g.rowsMux.Lock()
+	f.GetNames(names)
 	for i := range emps {
-		salary := rand.Intn(200000)
+		salary := g.rnd.Intn(200000)
 		emps[i] = newEmployee(names[i], salary+1, positions[i%len(positions)])
 	}
+	g.rowsMux.Unlock()
 	if err := g.storeEmployees(ctx, emps); err != nil {
 		return fmt.Errorf("failed to store the generated employees: %w", err)
 	}
+	if g.emails != nil {
+		if err := g.emails.write(emps); err != nil {
+			return fmt.Errorf("failed to write the emails: %w", err)
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,170 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// client is shared by all the workers of a load test, so that they use the same connection pool.
+type client struct {
+	http      *http.Client
+	targetURL string
+	// lookup is the reads operation of the default workload, the client sends it as the HTTP driver.
+	lookup *templateOp
+}
+
+func newClient(cfg Config) (*client, error) {
+	lookup, err := newTemplateOp(DefaultRequests([]OpWeight{{Op: OpReads, Weight: 1}}, cfg.HTTP)[0], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build the employee-by-email request: %w", err)
+	}
+	t, err := newTransport(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize the HTTP transport: %w", err)
+	}
+	return &client{
+		http: &http.Client{
+			Transport: t,
+			Timeout:   cfg.HTTP.Timeout,
+		},
+		targetURL: strings.TrimSuffix(cfg.HTTP.TargetURL, "/"),
+		lookup:    lookup,
+	}, nil
+}
+
+const (
+	dialTimeout      = time.Second * 5
+	dialKeepAlive    = time.Second * 30
+	idleConnTimeout  = time.Second * 90
+	handshakeTimeout = time.Second * 10
+)
+
+func newTransport(cfg Config) (*http.Transport, error) {
+	tlsCfg, err := newTLSConfig(cfg.HTTP.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	maxIdleConns := cfg.HTTP.MaxIdleConns
+	if maxIdleConns == 0 {
+		maxIdleConns = cfg.WorkersCount
+	}
+	maxIdleConnsPerHost := cfg.HTTP.MaxIdleConnsPerHost
+	if maxIdleConnsPerHost == 0 {
+		maxIdleConnsPerHost = cfg.WorkersCount
+	}
+
+	d := &net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: dialKeepAlive,
+	}
+	dial := d.DialContext
+	if cfg.HTTP.UnixSocket != "" {
+		socket := cfg.HTTP.UnixSocket
+		dial = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return d.DialContext(ctx, "unix", socket)
+		}
+	}
+
+	return &http.Transport{
+		DialContext:         dial,
+		TLSClientConfig:     tlsCfg,
+		TLSHandshakeTimeout: handshakeTimeout,
+		MaxIdleConns:        maxIdleConns,
+		MaxIdleConnsPerHost: maxIdleConnsPerHost,
+		MaxConnsPerHost:     cfg.HTTP.MaxConnsPerHost,
+		IdleConnTimeout:     idleConnTimeout,
+		DisableKeepAlives:   cfg.HTTP.DisableKeepAlives,
+	}, nil
+}
+
+func newTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	c := &tls.Config{
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		ServerName:         cfg.ServerName,
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in the CA file %s", cfg.CAFile)
+		}
+		c.RootCAs = pool
+	}
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, errors.New("both the client certificate and key files should be set")
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the client key pair: %w", err)
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
+
+// FindByEmail sends the employee-by-email request of the default workload, so the driver
+// shares the URL and the expected status codes with the templated lookups.
+func (c *client) FindByEmail(ctx context.Context, email string) (int, error) {
+	return c.lookup.do(ctx, c, &requestVars{lookupEmail: email, lookupKey: -1})
+}
+
+// send sends a request to the path relative to the target URL.
+// The response body is copied to respBody if it is not nil, otherwise it is discarded.
+func (c *client) send(
+	ctx context.Context,
+	method, path string,
+	body []byte,
+	headers http.Header,
+	respBody *bytes.Buffer,
+) (int, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.targetURL+path, r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create a request: %w", err)
+	}
+	for k, v := range headers {
+		req.Header[k] = v
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("http request has failed: %w", err)
+	}
+	if respBody != nil {
+		return readResponse(resp, respBody)
+	}
+	return readResponse(resp, io.Discard)
+}
+
+func readResponse(resp *http.Response, dst io.Writer) (int, error) {
+	defer resp.Body.Close()
+
+	// the body is drained so that the connection can be reused
+	if _, err := io.Copy(dst, resp.Body); err != nil {
+		return resp.StatusCode, fmt.Errorf("%w: %w", errBodyRead, err)
+	}
+	finishTrace(resp.Request.Context())
+
+	return resp.StatusCode, nil
+}
+
+func (c *client) Close() {
+	c.http.CloseIdleConnections()
+}
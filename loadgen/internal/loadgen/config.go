@@ -2,7 +2,85 @@ package loadgen
 
 import "time"
 
+const (
+	ImplDispatcher = "dispatcher"
+	ImplNominal    = "nominal"
+)
+
 type Config struct {
-	Duration     time.Duration
+	Duration time.Duration
+	// Warmup is the period before Duration during which the load is generated but not measured.
+	Warmup       time.Duration
 	WorkersCount int
+	Impl         string
+	// Rate switches the generator to the open model: requests are scheduled
+	// at the fixed arrival rate (per second) and handed to a pool of WorkersCount workers.
+	Rate int
+	// Stages describes the load profile. If set, it overrides Duration, and the stage targets
+	// are either the number of workers or the arrival rate depending on StagesTarget.
+	Stages       []Stage
+	StagesTarget string
+	// ThinkTime is the pause a closed-model worker makes after every request, unless the request
+	// has its own think time. Pacing, if set, makes every worker start a request once per interval.
+	// Together they model virtual users instead of saturated connections.
+	ThinkTime ThinkTime
+	Pacing    time.Duration
+	// Requests is the weighted mix of the requests, only lookups are sent if it is empty.
+	Requests []RequestSpec
+	// Keys controls which emails are looked up.
+	Keys KeysConfig
+	// DataFile is an optional CSV file, its columns can be used as placeholders in the requests.
+	DataFile string
+	// Thresholds are the pass/fail criteria checked at the end of the test.
+	Thresholds []Threshold
+	// AbortOnFail stops the test as soon as a threshold cannot pass anymore.
+	AbortOnFail bool
+	Report      ReportConfig
+	// ProgressInterval is how often the live statistics are printed, zero disables them.
+	ProgressInterval time.Duration
+	// MetricsAddr, if set, is the address the live metrics are served on in the Prometheus text format.
+	MetricsAddr string
+	// Seed determines the names and, for every name, the key, the operation and the think time,
+	// whichever worker sends the request. Zero means a random seed.
+	Seed int64
+	// FindMax, if enabled, replaces the single test with the search of the max throughput.
+	FindMax FindMaxConfig
+	// ErrorLogRate limits the number of individual errors logged per second, zero disables the logging.
+	ErrorLogRate int
+	// Driver is how the lookups are performed, DriverHTTP by default. DriverDSN is the database
+	// the DriverPgx driver queries directly.
+	Driver    string
+	DriverDSN string
+	HTTP      HTTPConfig
+}
+
+type HTTPConfig struct {
+	// TargetURL is the base URL of the service under test, e.g. http://localhost:8080.
+	TargetURL string
+	// EmailEndpoint is the path of the employee-by-email handler relative to TargetURL.
+	EmailEndpoint string
+	// EmployeeEndpoint is the path of the employee creation handler relative to TargetURL.
+	EmployeeEndpoint string
+	// UnixSocket, if set, makes the client dial the unix socket instead of the TargetURL host.
+	UnixSocket string
+	// Timeout limits a single request including reading the response body.
+	Timeout time.Duration
+
+	// MaxIdleConns and MaxIdleConnsPerHost size the keep-alive pool.
+	// A zero value means "one idle connection per worker".
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost limits the total number of connections, zero means no limit.
+	MaxConnsPerHost   int
+	DisableKeepAlives bool
+
+	TLS TLSConfig
+}
+
+type TLSConfig struct {
+	InsecureSkipVerify bool
+	ServerName         string
+	CAFile             string
+	CertFile           string
+	KeyFile            string
 }
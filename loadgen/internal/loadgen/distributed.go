@@ -0,0 +1,570 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"loadgen/internal/stats"
+)
+
+// CoordinatorConfig describes the distributed mode: the coordinator waits for the agents
+// to register, splits the load between them and merges their results into one report.
+type CoordinatorConfig struct {
+	// Listen is the address the agents register on, e.g. ":7070".
+	Listen string
+	Agents int
+	// StartDelay is the time between the last registration and the synchronized start,
+	// it should cover the agents preparing their tests, e.g. loading the known emails.
+	StartDelay time.Duration
+	// Token, if set, is the shared secret the agents have to present. The assignments carry
+	// the test config, including the DSNs, so the coordinator should not be reachable without it.
+	Token string
+}
+
+type AgentConfig struct {
+	// CoordinatorURL is the base URL of the coordinator, e.g. http://10.0.0.1:7070.
+	CoordinatorURL string
+	// Name identifies the agent in the coordinator logs.
+	Name string
+	// Token is the shared secret of the coordinator.
+	Token string
+}
+
+// resultTimeout is how long the coordinator waits for the results after the planned end of the test.
+const resultTimeout = 30 * time.Second
+
+// assignment is the share of the test the coordinator gives to an agent.
+type assignment struct {
+	ID     int
+	Config Config
+	// StartAt is the start time by the coordinator clock and Now is the coordinator time of the response,
+	// the agent waits for StartAt - Now, so the clocks do not need to be synchronized.
+	StartAt time.Time
+	Now     time.Time
+	// StatsInterval is how often the agent reports its live statistics.
+	StatsInterval time.Duration
+}
+
+type agentRegistration struct {
+	Name string
+}
+
+type statsResponse struct {
+	// Stop asks the agent to stop the test, e.g. because the coordinator has been interrupted.
+	Stop bool
+}
+
+type agentResult struct {
+	Result loadTestResult
+	// Error is set if the agent has failed to run the test.
+	Error string
+}
+
+type agentState struct {
+	name       string
+	assignment assignment
+	live       liveSnapshot
+	result     *agentResult
+}
+
+type coordinator struct {
+	cfg Config
+	cc  CoordinatorConfig
+
+	mux      *sync.Mutex
+	agents   []*agentState
+	started  bool
+	finished int
+	// ready is closed once all the agents have registered, done once all of them have sent the results.
+	ready chan struct{}
+	done  chan struct{}
+	stop  atomic.Bool
+}
+
+func newCoordinator(cfg Config, cc CoordinatorConfig) *coordinator {
+	return &coordinator{
+		cfg:   cfg,
+		cc:    cc,
+		mux:   &sync.Mutex{},
+		ready: make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+// Coordinate runs the test on the agents and reports the merged results.
+func Coordinate(ctx context.Context, cfg Config, cc CoordinatorConfig) error {
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+	log.Printf("seed: %d", cfg.Seed)
+	c := newCoordinator(cfg, cc)
+	ln, err := net.Listen("tcp", cc.Listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", cc.Listen, err)
+	}
+	srv := &http.Server{Handler: c.handler()}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("coordinator server has failed: %v", err)
+		}
+	}()
+	defer srv.Close()
+	log.Printf("waiting for %d agents on %s", cc.Agents, ln.Addr())
+	if host, _, _ := net.SplitHostPort(ln.Addr().String()); cc.Token == "" && !net.ParseIP(host).IsLoopback() {
+		log.Printf("warning: the coordinator accepts the agents without a token, anyone reaching %s gets the test config",
+			ln.Addr())
+	}
+
+	res, started, err := c.run(ctx)
+	if err != nil {
+		return err
+	}
+	return finish(ctx, cfg, res, started, time.Now())
+}
+
+func (c *coordinator) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /agents", c.register)
+	mux.HandleFunc("POST /agents/{id}/stats", c.receiveStats)
+	mux.HandleFunc("POST /agents/{id}/result", c.receiveResult)
+	if c.cc.Token == "" {
+		return mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(c.cc.Token)) != 1 {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// register blocks until all the agents have registered and responds with the assignment.
+func (c *coordinator) register(w http.ResponseWriter, r *http.Request) {
+	var reg agentRegistration
+	if err := json.NewDecoder(r.Body).Decode(&reg); err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode the registration: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	c.mux.Lock()
+	if c.started {
+		c.mux.Unlock()
+		http.Error(w, "the test has already started", http.StatusConflict)
+		return
+	}
+	a := &agentState{name: reg.Name}
+	c.agents = append(c.agents, a)
+	log.Printf("agent %q has registered (%d of %d)", reg.Name, len(c.agents), c.cc.Agents)
+	if len(c.agents) == c.cc.Agents {
+		c.start()
+	}
+	c.mux.Unlock()
+
+	select {
+	case <-c.ready:
+	case <-r.Context().Done():
+		c.mux.Lock()
+		defer c.mux.Unlock()
+		if !c.started {
+			c.remove(a)
+			log.Printf("agent %q has left", reg.Name)
+		}
+		return
+	}
+	c.mux.Lock()
+	asg := a.assignment
+	c.mux.Unlock()
+	asg.Now = time.Now()
+	writeJSON(w, asg)
+}
+
+// start assigns the shares of the test to the agents, the mutex should be held.
+func (c *coordinator) start() {
+	c.started = true
+	startAt := time.Now().Add(c.cc.StartDelay)
+	interval := c.cfg.ProgressInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	for i, a := range c.agents {
+		a.assignment = assignment{
+			ID:            i,
+			Config:        agentConfig(c.cfg, i, len(c.agents)),
+			StartAt:       startAt,
+			StatsInterval: interval,
+		}
+	}
+	close(c.ready)
+}
+
+func (c *coordinator) remove(a *agentState) {
+	for i, ag := range c.agents {
+		if ag == a {
+			c.agents = append(c.agents[:i], c.agents[i+1:]...)
+			return
+		}
+	}
+}
+
+// agent returns the registered agent with the id from the path, or responds with an error.
+func (c *coordinator) agent(w http.ResponseWriter, r *http.Request) *agentState {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 0 || id >= len(c.agents) || !c.started {
+		http.Error(w, fmt.Sprintf("unknown agent %q", r.PathValue("id")), http.StatusNotFound)
+		return nil
+	}
+	return c.agents[id]
+}
+
+func (c *coordinator) receiveStats(w http.ResponseWriter, r *http.Request) {
+	var s liveSnapshot
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode the stats: %v", err), http.StatusBadRequest)
+		return
+	}
+	c.mux.Lock()
+	a := c.agent(w, r)
+	if a != nil {
+		a.live = s
+	}
+	c.mux.Unlock()
+	if a != nil {
+		writeJSON(w, statsResponse{Stop: c.stop.Load()})
+	}
+}
+
+func (c *coordinator) receiveResult(w http.ResponseWriter, r *http.Request) {
+	var res agentResult
+	if err := json.NewDecoder(r.Body).Decode(&res); err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode the result: %v", err), http.StatusBadRequest)
+		return
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	a := c.agent(w, r)
+	if a == nil || a.result != nil {
+		return
+	}
+	a.result = &res
+	if res.Error != "" {
+		log.Printf("agent %q has failed: %s", a.name, res.Error)
+	} else {
+		log.Printf(
+			"agent %q has finished: ops: %d, errors: %d, ops per second: %.1f",
+			a.name, res.Result.Ops, res.Result.Errors, res.Result.OpsPerSecond(),
+		)
+	}
+	c.finished++
+	if c.finished == len(c.agents) {
+		close(c.done)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// snapshot sums up the latest live statistics of the agents.
+func (c *coordinator) snapshot() liveSnapshot {
+	s := liveSnapshot{
+		At:      time.Now(),
+		Latency: stats.NewHistogram(),
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for _, a := range c.agents {
+		s.Ops += a.live.Ops
+		s.Errors += a.live.Errors
+		s.InFlight += a.live.InFlight
+		s.ActiveWorkers += a.live.ActiveWorkers
+		s.Latency.Merge(a.live.Latency)
+	}
+	return s
+}
+
+// run waits for the agents, the end of the test and the results, and returns the merged results
+// along with the start time of the test.
+func (c *coordinator) run(ctx context.Context) (loadTestResult, time.Time, error) {
+	select {
+	case <-c.ready:
+	case <-ctx.Done():
+		return loadTestResult{}, time.Time{}, errInterrupted
+	}
+	log.Printf("all the agents have registered, the test starts in %v", c.cc.StartDelay)
+	startAt := time.Now().Add(c.cc.StartDelay)
+	if !sleep(ctx, c.cc.StartDelay) {
+		c.stop.Store(true)
+	}
+
+	stopProgress := startProgress(ctx, c.cfg, c)
+	planned := c.cfg.Warmup + c.cfg.Duration
+	if len(c.cfg.Stages) > 0 {
+		planned = stagesDuration(c.cfg.Stages)
+	}
+	deadline := time.NewTimer(time.Until(startAt) + planned + resultTimeout)
+	defer deadline.Stop()
+	interrupted := ctx.Done()
+wait:
+	for {
+		select {
+		case <-c.done:
+			break wait
+		case <-interrupted:
+			// the agents stop on the next stats report, their partial results are still awaited
+			c.stop.Store(true)
+			interrupted = nil
+			deadline.Reset(resultTimeout)
+		case <-deadline.C:
+			break wait
+		}
+	}
+	stopProgress()
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	res := newLoadTestResult(len(c.cfg.Stages))
+	var missing []string
+	for _, a := range c.agents {
+		switch {
+		case a.result == nil:
+			missing = append(missing, a.name)
+		case a.result.Error == "":
+			res.merge(a.result.Result)
+			res.Agents++
+		}
+	}
+	if len(missing) > 0 {
+		log.Printf("no results from the agents: %s, the results are partial", strings.Join(missing, ", "))
+		res.Interrupted = true
+	}
+	if res.Agents == 0 {
+		return loadTestResult{}, startAt, fmt.Errorf("no agent has completed the test")
+	}
+	return res, startAt, nil
+}
+
+// agentConfig returns the share of the test run by the i-th of n agents.
+func agentConfig(cfg Config, i, n int) Config {
+	c := cfg
+	c.WorkersCount = splitLoad(cfg.WorkersCount, i, n)
+	c.Rate = splitLoad(cfg.Rate, i, n)
+	if len(cfg.Stages) > 0 {
+		c.Stages = make([]Stage, len(cfg.Stages))
+		for j, s := range cfg.Stages {
+			s.From = splitLoad(s.From, i, n)
+			s.To = splitLoad(s.To, i, n)
+			c.Stages[j] = s
+		}
+	}
+	// the task seeds are derived from the agent seed, so the agents should not share it
+	c.Seed = cfg.Seed + int64(i)<<32
+	// the DSNs are only sent if the agent is going to use them
+	if c.Driver != DriverPgx {
+		c.DriverDSN = ""
+	}
+	if c.Keys.KnownEmailsFile != "" {
+		c.Keys.KnownEmailsDSN = ""
+	}
+	// the thresholds, the progress and the reports are handled by the coordinator
+	c.Thresholds = nil
+	c.AbortOnFail = false
+	c.Report = ReportConfig{}
+	c.ProgressInterval = 0
+	c.MetricsAddr = ""
+	c.FindMax = FindMaxConfig{}
+	return c
+}
+
+func splitLoad(total, i, n int) int {
+	share := total / n
+	if i < total%n {
+		share++
+	}
+	return share
+}
+
+// RunAgent registers with the coordinator and runs the assigned share of the test.
+func RunAgent(ctx context.Context, ac AgentConfig) error {
+	a := &agent{
+		baseURL: strings.TrimSuffix(ac.CoordinatorURL, "/"),
+		client:  &http.Client{},
+		token:   ac.Token,
+	}
+	asg, err := a.register(ctx, ac.Name)
+	if err != nil {
+		return err
+	}
+	startIn := asg.StartAt.Sub(asg.Now)
+	received := time.Now()
+	cfg := asg.Config
+	a.id = asg.ID
+	log.Printf(
+		"registered as agent #%d: workers: %d, rate: %d, seed: %d, start in %v",
+		asg.ID, cfg.WorkersCount, cfg.Rate, cfg.Seed, startIn,
+	)
+
+	res, err := a.runTest(ctx, cfg, startIn-time.Since(received), asg.StatsInterval)
+	if err != nil {
+		if perr := a.post(context.Background(), "result", agentResult{Error: err.Error()}, nil); perr != nil {
+			log.Printf("failed to report the failure to the coordinator: %v", perr)
+		}
+		return err
+	}
+	printResult(cfg, res)
+	if err := a.post(context.Background(), "result", agentResult{Result: res}, nil); err != nil {
+		return fmt.Errorf("failed to send the result to the coordinator: %w", err)
+	}
+	if res.Interrupted {
+		return errInterrupted
+	}
+	return nil
+}
+
+type agent struct {
+	baseURL string
+	client  *http.Client
+	token   string
+	id      int
+}
+
+// register retries until the coordinator is reachable, then waits for the assignment.
+func (a *agent) register(ctx context.Context, name string) (assignment, error) {
+	var asg assignment
+	for logged := false; ; {
+		err := postJSON(ctx, a.client, a.baseURL+"/agents", a.token, agentRegistration{Name: name}, &asg)
+		if err == nil {
+			return asg, nil
+		}
+		var statusErr *unexpectedStatusError
+		if errors.As(err, &statusErr) || ctx.Err() != nil {
+			return asg, fmt.Errorf("failed to register with the coordinator: %w", err)
+		}
+		if !logged {
+			log.Printf("waiting for the coordinator: %v", err)
+			logged = true
+		}
+		if !sleep(ctx, time.Second) {
+			return asg, errInterrupted
+		}
+	}
+}
+
+func (a *agent) runTest(
+	ctx context.Context,
+	cfg Config,
+	startIn time.Duration,
+	statsInterval time.Duration,
+) (loadTestResult, error) {
+	env, err := newTestEnv(ctx, cfg)
+	if err != nil {
+		return loadTestResult{}, err
+	}
+	defer env.close()
+	if !sleep(ctx, startIn) {
+		return loadTestResult{}, errInterrupted
+	}
+
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go a.streamStats(runCtx, wg, env.live, statsInterval, stop)
+	res, err := runLoadTest(runCtx, cfg, env)
+	interrupted := runCtx.Err() != nil
+	stop()
+	wg.Wait()
+	if err != nil {
+		return loadTestResult{}, err
+	}
+	res.Interrupted = interrupted
+	return res, nil
+}
+
+// streamStats reports the live statistics to the coordinator and stops the test if asked to.
+func (a *agent) streamStats(
+	ctx context.Context,
+	wg *sync.WaitGroup,
+	live *liveStats,
+	interval time.Duration,
+	stop context.CancelFunc,
+) {
+	defer wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		var resp statsResponse
+		if err := a.post(ctx, "stats", live.snapshot(), &resp); err != nil {
+			if ctx.Err() == nil {
+				log.Printf("failed to send the stats to the coordinator: %v", err)
+			}
+			continue
+		}
+		if resp.Stop {
+			log.Print("the coordinator has stopped the test")
+			stop()
+			return
+		}
+	}
+}
+
+func (a *agent) post(ctx context.Context, kind string, in, out any) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return postJSON(ctx, a.client, fmt.Sprintf("%s/agents/%d/%s", a.baseURL, a.id, kind), a.token, in, out)
+}
+
+// postJSON sends the request with the token, if set, in the Authorization header.
+func postJSON(ctx context.Context, client *http.Client, url, token string, in, out any) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("failed to create the request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%w: %s", &unexpectedStatusError{Code: resp.StatusCode}, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode the response: %w", err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("failed to write the response: %v", err)
+	}
+}
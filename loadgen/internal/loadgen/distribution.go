@@ -0,0 +1,216 @@
+package loadgen
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	DistUniform    = "uniform"
+	DistZipfian    = "zipfian"
+	DistHotspot    = "hotspot"
+	DistSequential = "sequential"
+)
+
+// KeyDistribution describes how often every key of the key space is requested.
+type KeyDistribution struct {
+	Kind string
+	// Skew is the exponent of the zipfian distribution, the k-th most popular key
+	// is requested proportionally to 1/k^Skew.
+	Skew float64
+	// HotTraffic is the share of the requests sent to the HotKeys share of the keys.
+	HotTraffic float64
+	HotKeys    float64
+}
+
+func (d KeyDistribution) String() string {
+	switch d.Kind {
+	case DistZipfian:
+		return fmt.Sprintf("%s:%v", d.Kind, d.Skew)
+	case DistHotspot:
+		return fmt.Sprintf("%s:%v/%v", d.Kind, d.HotTraffic*100, d.HotKeys*100)
+	}
+	return d.Kind
+}
+
+// ParseKeyDistribution parses the distribution in one of the forms:
+// "uniform", "sequential", "zipfian:skew" (e.g. "zipfian:1.1") or "hotspot:traffic%/keys%"
+// (e.g. "hotspot:90/10" sends 90% of the requests to 10% of the keys).
+func ParseKeyDistribution(s string) (KeyDistribution, error) {
+	kind, params, hasParams := strings.Cut(s, ":")
+	d := KeyDistribution{Kind: kind}
+	switch kind {
+	case DistUniform, DistSequential:
+		if hasParams {
+			return d, fmt.Errorf("%s distribution has no parameters", kind)
+		}
+	case DistZipfian:
+		d.Skew = 1
+		if hasParams {
+			skew, err := strconv.ParseFloat(params, 64)
+			if err != nil {
+				return d, fmt.Errorf("failed to parse the zipfian skew: %w", err)
+			}
+			d.Skew = skew
+		}
+	case DistHotspot:
+		traffic, keys, ok := strings.Cut(params, "/")
+		if !ok {
+			return d, fmt.Errorf("expected the hotspot:traffic%%/keys%% format")
+		}
+		t, err := strconv.ParseFloat(traffic, 64)
+		if err != nil {
+			return d, fmt.Errorf("failed to parse the hot traffic share: %w", err)
+		}
+		k, err := strconv.ParseFloat(keys, 64)
+		if err != nil {
+			return d, fmt.Errorf("failed to parse the hot keys share: %w", err)
+		}
+		d.HotTraffic, d.HotKeys = t/100, k/100
+	default:
+		return d, fmt.Errorf("unknown key distribution: %q", kind)
+	}
+	return d, d.validate()
+}
+
+func (d KeyDistribution) validate() error {
+	switch d.Kind {
+	case "", DistUniform, DistSequential:
+	case DistZipfian:
+		if d.Skew <= 0 {
+			return fmt.Errorf("zipfian skew should be greater than 0, got %v", d.Skew)
+		}
+	case DistHotspot:
+		if d.HotTraffic < 0 || d.HotTraffic > 1 {
+			return fmt.Errorf("hot traffic share should be between 0%% and 100%%, got %v%%", d.HotTraffic*100)
+		}
+		if d.HotKeys <= 0 || d.HotKeys >= 1 {
+			return fmt.Errorf("hot keys share should be between 0%% and 100%% exclusive, got %v%%", d.HotKeys*100)
+		}
+	default:
+		return fmt.Errorf("unknown key distribution: %q", d.Kind)
+	}
+	return nil
+}
+
+// keyChooser picks the index of the next key out of n keys. It is safe for concurrent use
+// as long as every worker passes its own rnd.
+type keyChooser interface {
+	next(rnd *rand.Rand) int
+}
+
+func newKeyChooser(d KeyDistribution, n int) keyChooser {
+	switch d.Kind {
+	case DistZipfian:
+		return newZipfianChooser(d.Skew, n)
+	case DistHotspot:
+		hot := int(math.Round(float64(n) * d.HotKeys))
+		hot = min(max(hot, 1), n)
+		return &hotspotChooser{n: n, hot: hot, traffic: d.HotTraffic}
+	case DistSequential:
+		return &sequentialChooser{n: int64(n)}
+	}
+	return uniformChooser(n)
+}
+
+type uniformChooser int
+
+func (c uniformChooser) next(rnd *rand.Rand) int {
+	return rnd.Intn(int(c))
+}
+
+// zipfianChooser samples the keys by the precomputed cumulative weights, unlike rand.Zipf
+// it supports any positive skew and does not keep a per-worker state.
+type zipfianChooser struct {
+	cumulative []float64
+}
+
+func newZipfianChooser(skew float64, n int) *zipfianChooser {
+	c := &zipfianChooser{cumulative: make([]float64, n)}
+	var total float64
+	for k := 0; k < n; k++ {
+		total += 1 / math.Pow(float64(k+1), skew)
+		c.cumulative[k] = total
+	}
+	return c
+}
+
+func (c *zipfianChooser) next(rnd *rand.Rand) int {
+	x := rnd.Float64() * c.cumulative[len(c.cumulative)-1]
+	return sort.SearchFloat64s(c.cumulative, x)
+}
+
+// hotspotChooser sends the traffic share of the requests to the first hot keys.
+type hotspotChooser struct {
+	n       int
+	hot     int
+	traffic float64
+}
+
+func (c *hotspotChooser) next(rnd *rand.Rand) int {
+	if c.hot == c.n || rnd.Float64() < c.traffic {
+		return rnd.Intn(c.hot)
+	}
+	return c.hot + rnd.Intn(c.n-c.hot)
+}
+
+// sequentialChooser walks the keys in order, the order is shared by all the workers.
+type sequentialChooser struct {
+	n       int64
+	counter atomic.Int64
+}
+
+func (c *sequentialChooser) next(*rand.Rand) int {
+	return int((c.counter.Add(1) - 1) % c.n)
+}
+
+// keyStats describes the realised distribution of the requested keys.
+type keyStats struct {
+	Distribution string
+	Keys         int
+	Requests     int64
+	// Touched is the number of distinct keys requested at least once.
+	Touched int
+	// TopKeyShare, Top1PctShare and Top10PctShare are the shares of the requests
+	// sent to the hottest key, the hottest 1% and 10% of the keys.
+	TopKeyShare   float64
+	Top1PctShare  float64
+	Top10PctShare float64
+}
+
+func newKeyStats(dist string, counts []int64) keyStats {
+	sorted := slices.Clone(counts)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] > sorted[j] })
+
+	s := keyStats{
+		Distribution: dist,
+		Keys:         len(sorted),
+	}
+	for _, c := range sorted {
+		s.Requests += c
+		if c > 0 {
+			s.Touched++
+		}
+	}
+	if s.Requests == 0 {
+		return s
+	}
+	share := func(keys int) float64 {
+		keys = max(keys, 1)
+		var sum int64
+		for _, c := range sorted[:keys] {
+			sum += c
+		}
+		return float64(sum) / float64(s.Requests)
+	}
+	s.TopKeyShare = share(1)
+	s.Top1PctShare = share(len(sorted) / 100)
+	s.Top10PctShare = share(len(sorted) / 10)
+	return s
+}
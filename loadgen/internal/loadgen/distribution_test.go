@@ -0,0 +1,74 @@
+package loadgen
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestParseKeyDistribution(t *testing.T) {
+	cases := []struct {
+		in   string
+		want KeyDistribution
+	}{
+		{"uniform", KeyDistribution{Kind: DistUniform}},
+		{"sequential", KeyDistribution{Kind: DistSequential}},
+		{"zipfian", KeyDistribution{Kind: DistZipfian, Skew: 1}},
+		{"zipfian:0.8", KeyDistribution{Kind: DistZipfian, Skew: 0.8}},
+		{"hotspot:90/10", KeyDistribution{Kind: DistHotspot, HotTraffic: 0.9, HotKeys: 0.1}},
+	}
+	for _, c := range cases {
+		got, err := ParseKeyDistribution(c.in)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", c.in, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%q: got %+v, want %+v", c.in, got, c.want)
+		}
+	}
+
+	for _, in := range []string{"", "normal", "uniform:1", "zipfian:0", "zipfian:x", "hotspot", "hotspot:90", "hotspot:90/100"} {
+		if _, err := ParseKeyDistribution(in); err == nil {
+			t.Errorf("%q: expected an error", in)
+		}
+	}
+}
+
+func TestKeyChoosers(t *testing.T) {
+	const keys, requests = 1000, 200000
+	sample := func(d KeyDistribution) keyStats {
+		c := newKeyChooser(d, keys)
+		rnd := rand.New(rand.NewSource(1))
+		counts := make([]int64, keys)
+		for i := 0; i < requests; i++ {
+			counts[c.next(rnd)]++
+		}
+		return newKeyStats(d.String(), counts)
+	}
+	near := func(got, want float64) bool {
+		return math.Abs(got-want) < 0.02
+	}
+
+	if s := sample(KeyDistribution{Kind: DistUniform}); !near(s.Top10PctShare, 0.1) || s.Touched != keys {
+		t.Errorf("uniform: unexpected stats %+v", s)
+	}
+	if s := sample(KeyDistribution{Kind: DistHotspot, HotTraffic: 0.9, HotKeys: 0.1}); !near(s.Top10PctShare, 0.9) {
+		t.Errorf("hotspot: top 10%% share is %v, want 0.9", s.Top10PctShare)
+	}
+	// the hottest key of zipf(1) over n keys gets 1/H(n) of the requests
+	var h float64
+	for k := 1; k <= keys; k++ {
+		h += 1 / float64(k)
+	}
+	if s := sample(KeyDistribution{Kind: DistZipfian, Skew: 1}); !near(s.TopKeyShare, 1/h) {
+		t.Errorf("zipfian: hottest key share is %v, want %v", s.TopKeyShare, 1/h)
+	}
+
+	c := newKeyChooser(KeyDistribution{Kind: DistSequential}, 3)
+	for i, want := range []int{0, 1, 2, 0, 1} {
+		if got := c.next(nil); got != want {
+			t.Errorf("sequential: request #%d got key %d, want %d", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	DriverHTTP = "http"
+	DriverPgx  = "pgx"
+)
+
+// Driver performs the email lookups of the workload, it is shared by all the workers.
+// The HTTP client is the default driver, the pgx one queries Postgres directly to measure
+// the overhead of the HTTP layer.
+type Driver interface {
+	// FindByEmail looks the employee up, the status code follows the employee-by-email endpoint:
+	// 200 if the employee exists and 404 if not. The other codes may come with an unexpectedStatusError.
+	FindByEmail(ctx context.Context, email string) (int, error)
+	Close()
+}
+
+func newDriver(ctx context.Context, cfg Config, c *client) (Driver, error) {
+	switch cfg.Driver {
+	case DriverHTTP, "":
+		return c, nil
+	case DriverPgx:
+		return newPgxDriver(ctx, cfg.DriverDSN, cfg.WorkersCount, cfg.HTTP.Timeout)
+	default:
+		return nil, fmt.Errorf("unknown driver: %q", cfg.Driver)
+	}
+}
+
+// employeeByEmailQuery is the query of store.GetEmployeeByEmail of the app.
+const employeeByEmailQuery = `SELECT e.first_name, e.last_name, e.salary, p.title, email
+	FROM employees e
+		JOIN positions p ON e.position = p.id
+	WHERE email = $1`
+
+type pgxDriver struct {
+	pool *pgxpool.Pool
+	// timeout limits every query like -timeout limits the HTTP requests, zero means no limit.
+	timeout time.Duration
+}
+
+func newPgxDriver(ctx context.Context, dsn string, conns int, timeout time.Duration) (*pgxDriver, error) {
+	connCfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the DSN: %w", err)
+	}
+	// like the HTTP pool, the connections are sized by the number of workers
+	connCfg.MaxConns = int32(conns)
+	pool, err := pgxpool.NewWithConfig(ctx, connCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize a pgx pool: %w", err)
+	}
+	pingCtx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+	if err := pool.Ping(pingCtx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to connect to the DB: %w", err)
+	}
+	return &pgxDriver{pool: pool, timeout: timeout}, nil
+}
+
+func (d *pgxDriver) FindByEmail(ctx context.Context, email string) (int, error) {
+	var (
+		firstName, lastName, position, foundEmail string
+		salary                                    float64
+	)
+	if d.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.timeout)
+		defer cancel()
+	}
+	err := d.pool.QueryRow(ctx, employeeByEmailQuery, email).
+		Scan(&firstName, &lastName, &salary, &position, &foundEmail)
+	return queryStatus(err)
+}
+
+// queryStatus maps the result of the query to the status code the app would respond with.
+func queryStatus(err error) (int, error) {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return http.StatusNotFound, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("query has failed: %w", err)
+	}
+	return http.StatusOK, nil
+}
+
+func (d *pgxDriver) Close() {
+	d.pool.Close()
+}
+
+// lookupOp is the email lookup performed by the driver instead of a templated HTTP request.
+type lookupOp struct {
+	driver Driver
+}
+
+func (op *lookupOp) name() string {
+	return OpReads
+}
+
+func (op *lookupOp) thinkTime() time.Duration {
+	return 0
+}
+
+func (op *lookupOp) do(ctx context.Context, _ *client, v *requestVars) (int, error) {
+	code, err := op.driver.FindByEmail(ctx, v.getLookup(varEmail))
+	if err != nil {
+		return code, err
+	}
+	if code != http.StatusOK && code != http.StatusNotFound {
+		return code, &unexpectedStatusError{Code: code}
+	}
+	return code, nil
+}
+
+// newLookupMix returns the mix of the driver lookups only.
+func newLookupMix(d Driver) *mix {
+	return &mix{
+		ops:        []operation{&lookupOp{driver: d}},
+		cumulative: []int{1},
+	}
+}
@@ -0,0 +1,136 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+
+	"loadgen/internal/common"
+)
+
+func TestQueryStatus(t *testing.T) {
+	errConn := errors.New("connection refused")
+	cases := []struct {
+		err     error
+		code    int
+		wantErr error
+	}{
+		{nil, http.StatusOK, nil},
+		{pgx.ErrNoRows, http.StatusNotFound, nil},
+		{fmt.Errorf("scan: %w", pgx.ErrNoRows), http.StatusNotFound, nil},
+		{errConn, 0, errConn},
+	}
+	for _, c := range cases {
+		code, err := queryStatus(c.err)
+		if code != c.code || !errors.Is(err, c.wantErr) || (c.wantErr == nil) != (err == nil) {
+			t.Errorf("%v: got %d, %v; want %d, %v", c.err, code, err, c.code, c.wantErr)
+		}
+	}
+}
+
+// fakeDriver responds with the status codes or errors set for the emails, 404 for the rest.
+type fakeDriver struct {
+	codes map[string]int
+	errs  map[string]error
+}
+
+func (d *fakeDriver) FindByEmail(_ context.Context, email string) (int, error) {
+	if err, ok := d.errs[email]; ok {
+		return 0, err
+	}
+	if code, ok := d.codes[email]; ok {
+		return code, nil
+	}
+	return http.StatusNotFound, nil
+}
+
+func (d *fakeDriver) Close() {}
+
+func TestLookupOp(t *testing.T) {
+	name := func(first string) common.Name {
+		return common.Name{FirstName: first, LastName: "Gopher"}
+	}
+	errQuery := errors.New("query has failed")
+	d := &fakeDriver{
+		codes: map[string]int{
+			emailFromName(name("Found")):  http.StatusOK,
+			emailFromName(name("Broken")): http.StatusInternalServerError,
+		},
+		errs: map[string]error{emailFromName(name("Failed")): errQuery},
+	}
+	m := newLookupMix(d)
+	rnd := rand.New(rand.NewSource(1))
+	op := m.pick(rnd)
+	if op.name() != OpReads {
+		t.Fatalf("the lookup mix picked %q, want %q", op.name(), OpReads)
+	}
+
+	cases := []struct {
+		first string
+		code  int
+		check func(error) bool
+	}{
+		{"Found", http.StatusOK, func(err error) bool { return err == nil }},
+		{"Missing", http.StatusNotFound, func(err error) bool { return err == nil }},
+		{"Broken", http.StatusInternalServerError, func(err error) bool {
+			var statusErr *unexpectedStatusError
+			return errors.As(err, &statusErr) && statusErr.Code == http.StatusInternalServerError
+		}},
+		{"Failed", 0, func(err error) bool { return errors.Is(err, errQuery) }},
+	}
+	for _, c := range cases {
+		code, err := op.do(context.Background(), nil, newRequestVars(name(c.first), rnd, nil, nil))
+		if code != c.code || !c.check(err) {
+			t.Errorf("%s: got %d, %v; want %d", c.first, code, err, c.code)
+		}
+	}
+}
+
+func TestHTTPDriverSharesDefaultLookup(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath())
+		if strings.HasPrefix(r.URL.Path, "/employee-by-email/broken") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+	cfg := newTestConfig(srv.URL)
+	c, err := newClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	m, err := newMix(DefaultRequests(DefaultWorkload(), cfg.HTTP), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const email = "a b@gopher-corp.com"
+	if code, err := c.FindByEmail(context.Background(), email); code != http.StatusNotFound || err != nil {
+		t.Errorf("driver: got %d, %v; want 404", code, err)
+	}
+	v := newRequestVars(common.Name{}, rand.New(rand.NewSource(1)), nil, nil)
+	v.lookupEmail = email
+	if _, err := m.ops[0].do(context.Background(), c, v); err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 || paths[0] != paths[1] {
+		t.Errorf("the driver and the default reads sent %v, want the same path", paths)
+	}
+
+	code, err := c.FindByEmail(context.Background(), "broken@gopher-corp.com")
+	var statusErr *unexpectedStatusError
+	if code != http.StatusInternalServerError || !errors.As(err, &statusErr) {
+		t.Errorf("driver: got %d, %v; want 500 with an unexpected status error", code, err)
+	}
+}
@@ -0,0 +1,162 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var errBodyRead = errors.New("failed to read the response body")
+
+const (
+	errCategoryConnRefused = "connection refused"
+	errCategoryConnReset   = "connection reset"
+	errCategoryTimeout     = "timeout"
+	errCategoryCanceled    = "context canceled"
+	errCategoryBodyRead    = "body read failure"
+	errCategoryOther       = "other"
+)
+
+// classifyError maps the error of an operation to the category it is aggregated by.
+func classifyError(err error) string {
+	var statusErr *unexpectedStatusError
+	var verifyErr *verificationError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &statusErr):
+		return fmt.Sprintf("http %d", statusErr.Code)
+	case errors.As(err, &verifyErr):
+		return "verification: " + verifyErr.Reason
+	case errors.Is(err, errBodyRead):
+		return errCategoryBodyRead
+	case errors.Is(err, context.Canceled):
+		return errCategoryCanceled
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return errCategoryTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return errCategoryConnRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return errCategoryConnReset
+	default:
+		return errCategoryOther
+	}
+}
+
+type errorCategory struct {
+	Count  int64
+	First  time.Time
+	Last   time.Time
+	Sample string
+}
+
+// errorStats aggregates the errors by the category.
+type errorStats map[string]*errorCategory
+
+func (s errorStats) add(category string, at time.Time, err error) {
+	c, ok := s[category]
+	if !ok {
+		c = &errorCategory{
+			First:  at,
+			Sample: err.Error(),
+		}
+		s[category] = c
+	}
+	c.Count++
+	c.Last = at
+}
+
+func (s errorStats) merge(o errorStats) {
+	for category, oc := range o {
+		c, ok := s[category]
+		if !ok {
+			cp := *oc
+			s[category] = &cp
+			continue
+		}
+		c.Count += oc.Count
+		if oc.First.Before(c.First) {
+			c.First = oc.First
+			c.Sample = oc.Sample
+		}
+		if oc.Last.After(c.Last) {
+			c.Last = oc.Last
+		}
+	}
+}
+
+// sorted returns the categories ordered by the number of errors.
+func (s errorStats) sorted() []string {
+	categories := make([]string, 0, len(s))
+	for c := range s {
+		categories = append(categories, c)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		ci, cj := s[categories[i]], s[categories[j]]
+		if ci.Count != cj.Count {
+			return ci.Count > cj.Count
+		}
+		return categories[i] < categories[j]
+	})
+	return categories
+}
+
+// errorLogger logs at most limit errors per second and summarizes the suppressed ones,
+// so that the console is not flooded at a high request rate.
+type errorLogger struct {
+	limit       int
+	mux         sync.Mutex
+	windowStart time.Time
+	logged      int
+	suppressed  int
+}
+
+func newErrorLogger(limit int) *errorLogger {
+	return &errorLogger{
+		limit: limit,
+	}
+}
+
+func (l *errorLogger) log(op string, err error) {
+	if l == nil || l.limit <= 0 {
+		return
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.windowStart) >= time.Second {
+		l.flushLocked()
+		l.windowStart = now
+		l.logged = 0
+	}
+	if l.logged >= l.limit {
+		l.suppressed++
+		return
+	}
+	l.logged++
+	log.Printf("%s: %v", op, err)
+}
+
+// flush reports the errors suppressed in the current window.
+func (l *errorLogger) flush() {
+	if l == nil {
+		return
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.flushLocked()
+}
+
+func (l *errorLogger) flushLocked() {
+	if l.suppressed > 0 {
+		log.Printf("%d more errors suppressed", l.suppressed)
+	}
+	l.suppressed = 0
+}
@@ -0,0 +1,213 @@
+package loadgen
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"loadgen/internal/report"
+)
+
+// FindMaxConfig describes the search of the max throughput: the load is increased in steps
+// until the latency or the error rate objective is breached.
+type FindMaxConfig struct {
+	Enabled bool
+	// Target is what is increased, the number of workers or the arrival rate.
+	Target string
+	Start  int
+	Step   int
+	Limit  int
+	// StepDuration is how long every step of the sweep runs.
+	StepDuration time.Duration
+	// MaxP99 is the latency objective, zero means no latency objective.
+	MaxP99 time.Duration
+	// MaxErrorRate is the max share of failed (and, for the rate target, dropped) requests.
+	MaxErrorRate float64
+	// CSVPath is the file the scalability curve is written to, it is printed if empty.
+	CSVPath string
+}
+
+type findMaxStep struct {
+	Load    int
+	Result  loadTestResult
+	Breach  string
+	Dropped float64
+}
+
+func (s findMaxStep) p99() time.Duration {
+	return s.Result.Latency.Quantile(0.99)
+}
+
+// power is throughput divided by latency, its maximum is the knee of the curve:
+// further load increases the latency more than it increases the throughput.
+func (s findMaxStep) power() float64 {
+	p99 := s.p99()
+	if p99 <= 0 {
+		return 0
+	}
+	return s.Result.OpsPerSecond() / p99.Seconds()
+}
+
+func findMax(ctx context.Context, cfg Config) error {
+	fm := cfg.FindMax
+	env, err := newFindMaxEnv(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer env.close()
+	stopProgress := startProgress(ctx, cfg, env.live)
+	defer stopProgress()
+	stopMetrics, err := startMetrics(cfg, env.live)
+	if err != nil {
+		return err
+	}
+	defer stopMetrics()
+
+	steps, err := runFindMax(ctx, cfg, env)
+	if err != nil {
+		return err
+	}
+	printFindMax(fm, steps)
+	if err := writeFindMaxCSV(fm, steps); err != nil {
+		return fmt.Errorf("failed to write the scalability curve: %w", err)
+	}
+	if ctx.Err() != nil {
+		return errInterrupted
+	}
+	return nil
+}
+
+// newFindMaxEnv returns the environment shared by the steps. The HTTP and DB connection pools
+// are sized by the workers, so for the workers target they are sized for the last step,
+// otherwise the steps above -workers would measure the connection churn instead of the app.
+func newFindMaxEnv(ctx context.Context, cfg Config) (*testEnv, error) {
+	if cfg.FindMax.Target != StageTargetRate {
+		cfg.WorkersCount = max(cfg.WorkersCount, cfg.FindMax.Limit)
+	}
+	return newTestEnv(ctx, cfg)
+}
+
+// runFindMax increases the load step by step until an objective is breached or the limit is reached.
+func runFindMax(ctx context.Context, cfg Config, env *testEnv) ([]findMaxStep, error) {
+	fm := cfg.FindMax
+	var steps []findMaxStep
+	for load := fm.Start; load <= fm.Limit && ctx.Err() == nil; load += fm.Step {
+		stepCfg := cfg
+		stepCfg.Duration = fm.StepDuration
+		stepCfg.Stages = nil
+		if fm.Target == StageTargetRate {
+			stepCfg.Rate = load
+		} else {
+			stepCfg.Rate = 0
+			stepCfg.WorkersCount = load
+		}
+
+		res, err := runLoadTest(ctx, stepCfg, env)
+		if err != nil {
+			return nil, err
+		}
+		if ctx.Err() != nil {
+			// the step has been interrupted, its results are not comparable with the others
+			break
+		}
+		s := findMaxStep{Load: load, Result: res}
+		if res.Scheduled > 0 {
+			s.Dropped = float64(res.Dropped) / float64(res.Scheduled)
+		}
+		s.Breach = fm.check(s)
+		steps = append(steps, s)
+		log.Printf(
+			"find max: %s %d: ops per second: %.1f, p99: %v, error rate: %.2f%%",
+			fm.Target, load, res.OpsPerSecond(), s.p99(), res.ErrorRate()*100,
+		)
+		if s.Breach != "" {
+			log.Printf("find max: %s %d: %s", fm.Target, load, s.Breach)
+			break
+		}
+	}
+	return steps, nil
+}
+
+// check returns the description of the breached objective, if any.
+func (fm FindMaxConfig) check(s findMaxStep) string {
+	if fm.MaxP99 > 0 && s.p99() > fm.MaxP99 {
+		return fmt.Sprintf("p99 %v exceeds %v", s.p99(), fm.MaxP99)
+	}
+	if rate := s.Result.ErrorRate(); rate > fm.MaxErrorRate {
+		return fmt.Sprintf("error rate %.2f%% exceeds %.2f%%", rate*100, fm.MaxErrorRate*100)
+	}
+	if s.Dropped > fm.MaxErrorRate {
+		return fmt.Sprintf("dropped rate %.2f%% exceeds %.2f%%", s.Dropped*100, fm.MaxErrorRate*100)
+	}
+	return ""
+}
+
+func printFindMax(fm FindMaxConfig, steps []findMaxStep) {
+	var best, knee *findMaxStep
+	for i := range steps {
+		s := &steps[i]
+		if s.Breach != "" {
+			continue
+		}
+		if best == nil || s.Result.OpsPerSecond() > best.Result.OpsPerSecond() {
+			best = s
+		}
+		if knee == nil || s.power() > knee.power() {
+			knee = s
+		}
+	}
+	if best == nil {
+		log.Printf("find max: no step has met the objectives")
+		return
+	}
+	log.Printf(
+		"find max: max throughput within the objectives: %.1f ops per second at %s %d (p99 %v)",
+		best.Result.OpsPerSecond(), fm.Target, best.Load, best.p99(),
+	)
+	log.Printf(
+		"find max: knee: %.1f ops per second at %s %d (p99 %v)",
+		knee.Result.OpsPerSecond(), fm.Target, knee.Load, knee.p99(),
+	)
+}
+
+func writeFindMaxCSV(fm FindMaxConfig, steps []findMaxStep) error {
+	if fm.CSVPath == "" {
+		return writeFindMaxSteps(os.Stdout, fm, steps)
+	}
+	f, err := os.Create(fm.CSVPath)
+	if err != nil {
+		return fmt.Errorf("failed to create the file: %w", err)
+	}
+	defer f.Close()
+
+	if err := writeFindMaxSteps(f, fm, steps); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func writeFindMaxSteps(w io.Writer, fm FindMaxConfig, steps []findMaxStep) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{fm.Target, "ops_per_second", "p50_ms", "p99_ms", "error_rate", "dropped_rate", "breach"})
+	f := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	for _, s := range steps {
+		_ = cw.Write([]string{
+			strconv.Itoa(s.Load),
+			f(s.Result.OpsPerSecond()),
+			f(report.Ms(s.Result.Latency.Quantile(0.5))),
+			f(report.Ms(s.p99())),
+			f(s.Result.ErrorRate()),
+			f(s.Dropped),
+			s.Breach,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
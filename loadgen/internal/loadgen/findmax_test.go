@@ -0,0 +1,158 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunFindMax(t *testing.T) {
+	// the server saturates at 2 concurrent requests
+	var inFlight atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code := http.StatusNotFound
+		if inFlight.Add(1) > 2 {
+			code = http.StatusInternalServerError
+		} else {
+			select {
+			case <-time.After(5 * time.Millisecond):
+			case <-r.Context().Done():
+			}
+		}
+		// the slot is released before the response, so that the worker's next request finds it free
+		inFlight.Add(-1)
+		w.WriteHeader(code)
+	}))
+	defer srv.Close()
+
+	cfg := newTestConfig(srv.URL)
+	cfg.WorkersCount = 1
+	cfg.FindMax = FindMaxConfig{
+		Enabled:      true,
+		Target:       StageTargetWorkers,
+		Start:        1,
+		Step:         1,
+		Limit:        8,
+		StepDuration: 150 * time.Millisecond,
+		// the requests cancelled at the end of a step may briefly overlap with the next one
+		MaxErrorRate: 0.1,
+	}
+	env, err := newFindMaxEnv(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.close()
+	if n := env.client.http.Transport.(*http.Transport).MaxIdleConnsPerHost; n != cfg.FindMax.Limit {
+		t.Errorf("the connection pool is sized for %d workers, want the limit %d", n, cfg.FindMax.Limit)
+	}
+
+	steps, err := runFindMax(context.Background(), cfg, env)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(steps) != 3 {
+		t.Fatalf("got %d steps, want the sweep to stop at the 3rd one: %+v", len(steps), steps)
+	}
+	for i, s := range steps {
+		if s.Load != i+1 {
+			t.Errorf("step #%d: load %d, want %d", i+1, s.Load, i+1)
+		}
+		if breached := s.Breach != ""; breached != (i == 2) {
+			t.Errorf("step #%d: breach %q", i+1, s.Breach)
+		}
+	}
+}
+
+func findMaxResult(opsPerSecond int64, p99 time.Duration, errors int64) loadTestResult {
+	r := newLoadTestResult(0)
+	r.Duration = time.Second
+	r.Ops = opsPerSecond
+	r.Errors = errors
+	for i := int64(0); i < opsPerSecond; i++ {
+		r.Latency.Record(p99)
+	}
+	return r
+}
+
+func TestFindMaxCheck(t *testing.T) {
+	fm := FindMaxConfig{MaxP99: 20 * time.Millisecond, MaxErrorRate: 0.01}
+	cases := []struct {
+		name string
+		step findMaxStep
+		want string
+	}{
+		{"met", findMaxStep{Result: findMaxResult(100, 10*time.Millisecond, 1)}, ""},
+		{"latency", findMaxStep{Result: findMaxResult(100, 30*time.Millisecond, 0)}, "p99"},
+		{"errors", findMaxStep{Result: findMaxResult(100, 10*time.Millisecond, 10)}, "error rate"},
+		{"dropped", findMaxStep{Result: findMaxResult(100, 10*time.Millisecond, 0), Dropped: 0.5}, "dropped rate"},
+	}
+	for _, c := range cases {
+		got := fm.check(c.step)
+		if (c.want == "") != (got == "") || !strings.HasPrefix(got, c.want) {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+	if got := (FindMaxConfig{MaxErrorRate: 0.01}).check(cases[1].step); got != "" {
+		t.Errorf("no latency objective: got %q", got)
+	}
+}
+
+func TestPrintFindMax(t *testing.T) {
+	logs := &bytes.Buffer{}
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(logs)
+
+	fm := FindMaxConfig{Target: StageTargetWorkers}
+	printFindMax(fm, []findMaxStep{
+		{Load: 1, Result: findMaxResult(100, 10*time.Millisecond, 0)},
+		{Load: 2, Result: findMaxResult(180, 12*time.Millisecond, 0)},
+		{Load: 3, Result: findMaxResult(200, 40*time.Millisecond, 0)},
+		{Load: 4, Result: findMaxResult(300, 50*time.Millisecond, 0), Breach: "p99 50ms exceeds 20ms"},
+	})
+	out := logs.String()
+	if !strings.Contains(out, "max throughput within the objectives: 200.0 ops per second at workers 3") {
+		t.Errorf("the max throughput should skip the breached step:\n%s", out)
+	}
+	if !strings.Contains(out, "knee: 180.0 ops per second at workers 2") {
+		t.Errorf("the knee should be at the max throughput to latency ratio:\n%s", out)
+	}
+
+	logs.Reset()
+	printFindMax(fm, []findMaxStep{{Load: 1, Result: findMaxResult(100, 10*time.Millisecond, 0), Breach: "x"}})
+	if !strings.Contains(logs.String(), "no step has met the objectives") {
+		t.Errorf("unexpected output:\n%s", logs.String())
+	}
+}
+
+func TestWriteFindMaxCSV(t *testing.T) {
+	fm := FindMaxConfig{Target: StageTargetWorkers, CSVPath: filepath.Join(t.TempDir(), "curve.csv")}
+	steps := []findMaxStep{
+		{Load: 1, Result: findMaxResult(100, 10*time.Millisecond, 0)},
+		{Load: 2, Result: findMaxResult(180, 40*time.Millisecond, 0), Breach: "p99 40ms exceeds 20ms"},
+	}
+	if err := writeFindMaxCSV(fm, steps); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(fm.CSVPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "workers,ops_per_second") ||
+		!strings.HasPrefix(lines[2], "2,180,") || !strings.HasSuffix(lines[2], ",p99 40ms exceeds 20ms") {
+		t.Errorf("unexpected CSV:\n%s", b)
+	}
+
+	fm.CSVPath = filepath.Join(t.TempDir(), "missing", "curve.csv")
+	if err := writeFindMaxCSV(fm, steps); err == nil {
+		t.Errorf("expected an error for a missing directory")
+	}
+}
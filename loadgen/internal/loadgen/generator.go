@@ -2,66 +2,427 @@ package loadgen
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
-	"net/http"
-	"net/url"
+	"os"
+	"sync"
 	"time"
 
 	"loadgen/internal/common"
 )
 
 func Generate(ctx context.Context, cfg Config) error {
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+	log.Printf("seed: %d", cfg.Seed)
+	if cfg.FindMax.Enabled {
+		return findMax(ctx, cfg)
+	}
+	started := time.Now()
 	res, err := generate(ctx, cfg)
 	if err != nil {
 		return err
 	}
-	opsPerSecond := res.Ops / int64(res.Duration.Seconds())
-	log.Printf("ops per second: %d", opsPerSecond)
-	return nil
+	return finish(ctx, cfg, res, started, time.Now())
 }
 
-type loadTestResult struct {
-	Duration time.Duration
-	Ops      int64
+// finish prints the results of the test, checks the thresholds and writes the reports.
+func finish(ctx context.Context, cfg Config, res loadTestResult, started, finished time.Time) error {
+	if ctx.Err() != nil {
+		res.Interrupted = true
+		log.Print("the load test has been interrupted, the results are partial")
+	}
+	if res.Aborted {
+		log.Print("the load test has been aborted, the results are partial")
+	}
+
+	printResult(cfg, res)
+	thresholds := checkThresholds(cfg.Thresholds, res)
+	printThresholds(thresholds)
+	if err := writeReports(cfg, res, thresholds, started, finished); err != nil {
+		return fmt.Errorf("failed to write the report: %w", err)
+	}
+	if err := failedThresholds(thresholds); err != nil {
+		return err
+	}
+	if res.Interrupted {
+		return errInterrupted
+	}
+	return nil
 }
 
+var errInterrupted = errors.New("the load test has been interrupted")
+
 func generate(ctx context.Context, cfg Config) (loadTestResult, error) {
-	f, err := common.NewNamesFetcher()
+	env, err := newTestEnv(ctx, cfg)
+	if err != nil {
+		return loadTestResult{}, err
+	}
+	defer env.close()
+	stopProgress := startProgress(ctx, cfg, env.live)
+	defer stopProgress()
+	stopMetrics, err := startMetrics(cfg, env.live)
+	if err != nil {
+		return loadTestResult{}, err
+	}
+	defer stopMetrics()
+
+	runCtx := ctx
+	if cfg.AbortOnFail && len(cfg.Thresholds) > 0 {
+		var abort context.CancelFunc
+		runCtx, abort = context.WithCancel(ctx)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		go watchThresholds(runCtx, wg, cfg.Thresholds, env.live, plannedRequests(cfg), cfg.Warmup, abort)
+		// the watcher only exits when the context is done, so it is cancelled before the wait
+		defer func() {
+			abort()
+			wg.Wait()
+		}()
+	}
+
+	res, err := runLoadTest(runCtx, cfg, env)
+	if err != nil {
+		return loadTestResult{}, err
+	}
+	res.Aborted = runCtx.Err() != nil && ctx.Err() == nil
+	res.Keys = env.emails.stats(res.keyRequests)
+	return res, nil
+}
+
+func newTestEnv(ctx context.Context, cfg Config) (*testEnv, error) {
+	f, err := common.NewNamesFetcher(cfg.Seed)
 	if err != nil {
-		return loadTestResult{}, fmt.Errorf("failed to get a new names fetcher: %w", err)
+		return nil, fmt.Errorf("failed to get a new names fetcher: %w", err)
 	}
+	var data *dataSet
+	if cfg.DataFile != "" {
+		if data, err = loadDataSet(cfg.DataFile); err != nil {
+			return nil, err
+		}
+	}
+	requests := cfg.Requests
+	if len(requests) == 0 {
+		requests = DefaultRequests(DefaultWorkload(), cfg.HTTP)
+	}
+	emails, err := newEmailSource(ctx, cfg.Keys, f)
+	if err != nil {
+		return nil, err
+	}
+	if emails != nil {
+		log.Printf("keys: %d, distribution: %v, hit ratio: %.2f", len(emails.keys), emails.dist, emails.hitRatio)
+	}
+	c, err := newClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize the HTTP client: %w", err)
+	}
+	d, err := newDriver(ctx, cfg, c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize the %s driver: %w", cfg.Driver, err)
+	}
+	var m *mix
+	if cfg.Driver == DriverPgx {
+		// the direct driver only supports the lookups
+		m = newLookupMix(d)
+	} else if m, err = newMix(requests, data); err != nil {
+		return nil, fmt.Errorf("invalid workload: %w", err)
+	}
+	return &testEnv{
+		names:  f,
+		seed:   cfg.Seed,
+		client: c,
+		driver: d,
+		mix:    m,
+		data:   data,
+		emails: emails,
+		live:   newLiveStats(),
+		errLog: newErrorLogger(cfg.ErrorLogRate),
+		pacer: pacer{
+			think:  cfg.ThinkTime,
+			pacing: cfg.Pacing,
+		},
+	}, nil
+}
 
-	return runGeneratorNominal(ctx, cfg, f)
-	//return runGenerator(ctx, cfg, f)
+// startProgress starts printing the live statistics, the returned function stops it.
+func startProgress(ctx context.Context, cfg Config, live liveSource) func() {
+	if cfg.ProgressInterval <= 0 {
+		return func() {}
+	}
+	progressCtx, stopProgress := context.WithCancel(ctx)
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	p := &progressReporter{
+		stats:    live,
+		interval: cfg.ProgressInterval,
+		tty:      isTerminal(os.Stdout),
+	}
+	go p.run(progressCtx, wg)
+	return func() {
+		stopProgress()
+		wg.Wait()
+	}
+}
+
+func runLoadTest(ctx context.Context, cfg Config, env *testEnv) (loadTestResult, error) {
+	f := env.names
+	if cfg.Rate > 0 || (len(cfg.Stages) > 0 && cfg.StagesTarget == StageTargetRate) {
+		return runRateGenerator(ctx, cfg, f, env)
+	}
+	if len(cfg.Stages) > 0 {
+		return runStagedGenerator(ctx, cfg, f, env)
+	}
+
+	switch cfg.Impl {
+	case ImplNominal:
+		return runGeneratorNominal(ctx, cfg, f, env.driver, env.live, env.errLog)
+	case ImplDispatcher, "":
+		return runGenerator(ctx, cfg, f, env)
+	default:
+		return loadTestResult{}, fmt.Errorf("unknown generator implementation: %q", cfg.Impl)
+	}
 }
 
 type namesFetcher interface {
 	GetNames(dst []common.Name)
 }
 
-func runGenerator(ctx context.Context, cfg Config, f namesFetcher) (loadTestResult, error) {
-	return loadTestResult{}, fmt.Errorf("NYI")
+// testEnv holds the dependencies shared by all the workers of a load test.
+type testEnv struct {
+	names   namesFetcher
+	seed    int64
+	client  *client
+	driver  Driver
+	mix     *mix
+	data    *dataSet
+	emails  *emailSource
+	profile *profile
+	live    *liveStats
+	errLog  *errorLogger
+	pacer   pacer
+	// warmupEnd is the moment the measurement starts, the earlier requests are accounted separately.
+	warmupEnd time.Time
 }
 
-func generateRandomEmail(names []common.Name) string {
-	idx := rand.Intn(len(names))
-	n := names[idx]
-	return fmt.Sprintf("%s.%s@gopher-corp.com", n.FirstName, n.LastName)
+func (e *testEnv) close() {
+	e.errLog.flush()
+	e.driver.Close()
+	e.client.Close()
 }
 
-func sendRequest(email string) (int, error) {
-	emailEscaped := url.PathEscape(email)
-	u, err := url.JoinPath("http://localhost:8080/employee-by-email/", emailEscaped)
-	if err != nil {
-		return 0, fmt.Errorf("failed to join the URL path: %w", err)
+// withWarmup returns a copy of the environment which accounts the requests started
+// before the warmup end separately.
+func (e *testEnv) withWarmup(warmupEnd time.Time) *testEnv {
+	c := *e
+	c.warmupEnd = warmupEnd
+	return &c
+}
+
+// withProfile returns a copy of the environment which maps the requests to the stages of the profile.
+func (e *testEnv) withProfile(p *profile) *testEnv {
+	c := *e
+	c.profile = p
+	return &c
+}
+
+const dispatcherBatchLen = 500
+
+func runGenerator(ctx context.Context, cfg Config, f namesFetcher, env *testEnv) (loadTestResult, error) {
+	res := newLoadTestResult(0)
+
+	workerCtx, cancelWorkerCtx := context.WithTimeout(ctx, cfg.Warmup+cfg.Duration)
+	defer cancelWorkerCtx()
+
+	tasks := make(chan nameBatch, cfg.WorkersCount)
+	results := make(chan workerResult, cfg.WorkersCount)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(cfg.WorkersCount + 1)
+
+	start := time.Now()
+	env = env.withWarmup(start.Add(cfg.Warmup))
+	go dispatcher(workerCtx, wg, f, env.seed, tasks)
+	for i := 0; i < cfg.WorkersCount; i++ {
+		go worker(workerCtx, nil, wg, env, tasks, results)
+	}
+
+	wg.Wait()
+	duration := time.Since(start)
+	close(results)
+
+	for r := range results {
+		res.addWorkerResult(r)
+	}
+	res.setDuration(duration, nil, cfg.Warmup)
+	return res, nil
+}
+
+// nameBatch is the batch of names handed out to a worker.
+// The requests of the batch use the random source seeded by seed rather than the one of the worker,
+// so that they are the same whichever worker happens to take the batch.
+type nameBatch struct {
+	names []common.Name
+	seed  int64
+}
+
+// dispatcher keeps fetching fresh batches of names and hands them out to the workers
+// until the context is done. The tasks channel is closed on exit.
+func dispatcher(ctx context.Context, wg *sync.WaitGroup, f namesFetcher, seed int64, tasks chan<- nameBatch) {
+	defer wg.Done()
+	defer close(tasks)
+
+	for i := int64(0); ; i++ {
+		names := make([]common.Name, dispatcherBatchLen)
+		f.GetNames(names)
+		select {
+		case tasks <- nameBatch{names: names, seed: taskSeed(seed, i)}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// taskSeed returns the seed of the i-th task handed out to the workers.
+func taskSeed(seed, i int64) int64 {
+	return seed + i + 1
+}
+
+// newWorkerRand returns the random source of the worker, the sequence of every worker
+// is determined by the seed of the test.
+func newWorkerRand(seed int64, id int) *rand.Rand {
+	return rand.New(rand.NewSource(seed + int64(id) + 1))
+}
+
+// do performs the operation and records its outcome.
+// The latency is measured from start, which is not necessarily the moment the request is sent.
+// A request interrupted by the end of the test is not an error, it is only counted as cancelled.
+func (r *workerResult) do(
+	ctx context.Context,
+	env *testEnv,
+	op operation,
+	n common.Name,
+	rnd *rand.Rand,
+	start time.Time,
+) {
+	env.live.requestStarted()
+	tr := newRequestTrace()
+	vars := newRequestVars(n, rnd, env.data, env.emails)
+	code, err := op.do(tr.withTrace(ctx), env.client, vars)
+	latency := time.Since(start)
+	if start.Before(env.warmupEnd) {
+		r = r.warmup()
+	}
+	if err != nil && ctx.Err() != nil {
+		env.live.requestCancelled()
+		r.recordCancelled(op.name(), env.profile.stageAt(start))
+		return
 	}
-	resp, err := http.DefaultClient.Get(u)
+	r.recordKey(vars.lookupKey)
+	r.Phases.record(tr)
+	env.live.requestFinished(op.name(), code, latency, err)
 	if err != nil {
-		return 0, fmt.Errorf("http request has failed: %w", err)
+		env.errLog.log(op.name(), err)
+	}
+	r.record(op.name(), env.profile.stageAt(start), code, latency, err)
+}
+
+// worker sends the requests until the context is done or the stop channel is closed.
+// Unlike the context, the stop signal does not interrupt the request in flight.
+func worker(
+	ctx context.Context,
+	stop <-chan struct{},
+	wg *sync.WaitGroup,
+	env *testEnv,
+	tasks <-chan nameBatch,
+	results chan<- workerResult,
+) {
+	defer wg.Done()
+	env.live.workerStarted()
+	defer env.live.workerStopped()
+
+	res := newWorkerResult(env.profile.stagesCount())
+	defer func() {
+		results <- res
+	}()
+
+	for {
+		var batch nameBatch
+		select {
+		case <-ctx.Done():
+			return
+		case <-stop:
+			return
+		case t, ok := <-tasks:
+			if !ok {
+				return
+			}
+			batch = t
+		}
+
+		rnd := rand.New(rand.NewSource(batch.seed))
+		for _, n := range batch.names {
+			if ctx.Err() != nil || stopped(stop) {
+				return
+			}
+			op := env.mix.pick(rnd)
+			start := time.Now()
+			res.do(ctx, env, op, n, rnd, start)
+			if !rest(ctx, stop, env.pacer.pause(op, rnd, start)) {
+				return
+			}
+		}
+	}
+}
+
+func stopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
 	}
-	defer resp.Body.Close()
+}
 
-	return resp.StatusCode, nil
+// rest is sleep which is also interrupted by the stop signal of the worker.
+func rest(ctx context.Context, stop <-chan struct{}, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil && !stopped(stop)
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-stop:
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// sleep pauses for d and reports whether the context is still alive.
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+func generateRandomEmail(rnd *rand.Rand, names []common.Name) string {
+	idx := rnd.Intn(len(names))
+	return emailFromName(names[idx])
+}
+
+func emailFromName(n common.Name) string {
+	return fmt.Sprintf("%s.%s@gopher-corp.com", n.FirstName, n.LastName)
 }
@@ -2,61 +2,90 @@ package loadgen
 
 import (
 	"context"
-	"log"
 	"net/http"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"loadgen/internal/common"
 )
 
-func runGeneratorNominal(ctx context.Context, cfg Config, f namesFetcher) (loadTestResult, error) {
-	res := loadTestResult{}
+func runGeneratorNominal(
+	ctx context.Context,
+	cfg Config,
+	f namesFetcher,
+	d Driver,
+	live *liveStats,
+	errLog *errorLogger,
+) (loadTestResult, error) {
+	res := newLoadTestResult(0)
+	resMux := &sync.Mutex{}
 
 	const nameBatchLen = 1000
-	tasks := make(chan []common.Name, cfg.WorkersCount)
-	for i := 0; i < cfg.WorkersCount; i++ {
-		names := make([]common.Name, nameBatchLen)
-		f.GetNames(names)
-		tasks <- names
+	// every worker gets its batch by its index, so that the run is determined by the seed
+	batches := make([][]common.Name, cfg.WorkersCount)
+	for i := range batches {
+		batches[i] = make([]common.Name, nameBatchLen)
+		f.GetNames(batches[i])
 	}
 
 	wg := &sync.WaitGroup{}
 	wg.Add(cfg.WorkersCount)
 
-	workerCtx, cancelWorkerCtx := context.WithTimeout(ctx, cfg.Duration)
+	workerCtx, cancelWorkerCtx := context.WithTimeout(ctx, cfg.Warmup+cfg.Duration)
 	defer cancelWorkerCtx()
 
 	start := time.Now()
+	warmupEnd := start.Add(cfg.Warmup)
 	for i := 0; i < cfg.WorkersCount; i++ {
 		go func() {
 			defer wg.Done()
+			live.workerStarted()
+			defer live.workerStopped()
 
-			names := <-tasks
+			names := batches[i]
+			rnd := newWorkerRand(cfg.Seed, i)
+			workerRes := newWorkerResult(0)
+			defer func() {
+				resMux.Lock()
+				defer resMux.Unlock()
+				res.addWorkerResult(workerRes)
+			}()
 			for {
 				select {
 				case <-workerCtx.Done():
 					return
 				default:
 				}
-				email := generateRandomEmail(names)
-				code, err := sendRequest(email)
-				if err != nil {
-					log.Printf("failed to send request: %v", err)
-					continue
+				email := generateRandomEmail(rnd, names)
+				start := time.Now()
+				live.requestStarted()
+				tr := newRequestTrace()
+				code, err := d.FindByEmail(tr.withTrace(workerCtx), email)
+				elapsed := time.Since(start)
+				r := &workerRes
+				if start.Before(warmupEnd) {
+					r = r.warmup()
+				}
+				if err != nil && workerCtx.Err() != nil {
+					live.requestCancelled()
+					r.recordCancelled("", -1)
+					return
+				}
+				r.Phases.record(tr)
+				if err == nil && code != http.StatusOK && code != http.StatusNotFound {
+					err = &unexpectedStatusError{Code: code}
 				}
-				if code != http.StatusOK && code != http.StatusNotFound {
-					log.Printf("an unexpected status code received: %d", code)
-					continue
+				live.requestFinished(OpReads, code, elapsed, err)
+				if err != nil {
+					errLog.log("failed to send request", err)
 				}
-				_ = atomic.AddInt64(&res.Ops, 1)
+				r.record("", -1, code, elapsed, err)
 			}
 		}()
 	}
 
 	wg.Wait()
-	res.Duration = time.Since(start)
+	res.setDuration(time.Since(start), nil, cfg.Warmup)
 
 	return res, nil
 }
@@ -0,0 +1,92 @@
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunGeneratorNominalLiveStats(t *testing.T) {
+	srv := newScriptedServer(
+		scriptedResponse{http.StatusOK, time.Millisecond},
+		scriptedResponse{http.StatusInternalServerError, time.Millisecond},
+	)
+	defer srv.Close()
+
+	cfg := newTestConfig(srv.URL)
+	cfg.Duration = 200 * time.Millisecond
+	env, err := newTestEnv(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := runGeneratorNominal(context.Background(), cfg, &fakeNames{}, env.driver, env.live, env.errLog)
+	env.close()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s := env.live.snapshot()
+	if res.Ops == 0 || s.Ops != res.Ops || s.Errors != res.Errors || s.Latency.Count() != res.Ops {
+		t.Errorf("live stats: %d ops, %d errors, %d latencies; want %d ops and %d errors",
+			s.Ops, s.Errors, s.Latency.Count(), res.Ops, res.Errors)
+	}
+	if s.InFlight != 0 || s.ActiveWorkers != 0 {
+		t.Errorf("%d requests in flight and %d active workers after the test", s.InFlight, s.ActiveWorkers)
+	}
+
+	// -metrics-addr serves the same live statistics
+	b := &strings.Builder{}
+	if err := writeMetrics(b, env.live); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		fmt.Sprintf(`loadgen_requests_total{op="reads",status="200"} %d`, res.StatusCodes[http.StatusOK]),
+		fmt.Sprintf(`loadgen_requests_total{op="reads",status="500"} %d`, res.StatusCodes[http.StatusInternalServerError]),
+		fmt.Sprintf("loadgen_request_errors_total %d", res.Errors),
+		fmt.Sprintf("loadgen_request_duration_seconds_count %d", res.Ops),
+	} {
+		if !strings.Contains(b.String(), want+"\n") {
+			t.Errorf("no %q in the metrics:\n%s", want, b)
+		}
+	}
+}
+
+func TestGenerateNominalAbortOnFail(t *testing.T) {
+	srv := newScriptedServer(scriptedResponse{http.StatusOK, 20 * time.Millisecond})
+	defer srv.Close()
+
+	cases := []struct {
+		threshold string
+		duration  time.Duration
+		aborted   bool
+		// runFor is how long the test should take: the watcher checks the thresholds every second
+		runFor time.Duration
+	}{
+		{"max<5ms", 5 * time.Second, true, thresholdCheckInterval},
+		{"max<5s", 200 * time.Millisecond, false, 200 * time.Millisecond},
+	}
+	for _, c := range cases {
+		cfg := newTestConfig(srv.URL)
+		cfg.Impl = ImplNominal
+		cfg.Duration = c.duration
+		th, err := ParseThreshold(c.threshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.Thresholds = []Threshold{th}
+		cfg.AbortOnFail = true
+
+		start := time.Now()
+		res, err := generate(context.Background(), cfg)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.threshold, err)
+		}
+		if elapsed := time.Since(start); res.Aborted != c.aborted || elapsed > c.runFor+stopBound {
+			t.Errorf("%s: aborted %v in %v, want %v in at most %v",
+				c.threshold, res.Aborted, elapsed, c.aborted, c.runFor+stopBound)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package loadgen
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"loadgen/internal/common"
+)
+
+type rateTask struct {
+	Name common.Name
+	// Intended is the moment the request should have been sent according to the schedule.
+	// Latencies are measured from it, so that the queueing caused by a slow server
+	// is not hidden from the results (coordinated omission).
+	Intended time.Time
+	// Seed seeds the random source of the request, so that it does not depend on the worker sending it.
+	Seed int64
+}
+
+func runRateGenerator(ctx context.Context, cfg Config, f namesFetcher, env *testEnv) (loadTestResult, error) {
+	testDuration := cfg.Warmup + cfg.Duration
+	if len(cfg.Stages) > 0 {
+		testDuration = stagesDuration(cfg.Stages)
+	}
+	res := newLoadTestResult(len(cfg.Stages))
+
+	workerCtx, cancelWorkerCtx := context.WithTimeout(ctx, testDuration)
+	defer cancelWorkerCtx()
+
+	// the channel is unbuffered: a request is dropped if no worker is ready to take it right away
+	tasks := make(chan rateTask)
+	results := make(chan workerResult, cfg.WorkersCount)
+	schedulerResults := make(chan schedulerResult, 1)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(cfg.WorkersCount + 1)
+
+	start := time.Now()
+	env = env.withProfile(newProfile(cfg.Stages, start)).withWarmup(start.Add(cfg.Warmup))
+	s := &rateScheduler{
+		fetcher:   f,
+		seed:      env.seed,
+		rate:      cfg.Rate,
+		start:     start,
+		warmupEnd: env.warmupEnd,
+		profile:   env.profile,
+		live:      env.live,
+		tasks:     tasks,
+		results:   schedulerResults,
+	}
+	go s.run(workerCtx, wg)
+	for i := 0; i < cfg.WorkersCount; i++ {
+		go rateWorker(workerCtx, wg, env, tasks, results)
+	}
+
+	wg.Wait()
+	duration := time.Since(start)
+	close(results)
+
+	for r := range results {
+		res.addWorkerResult(r)
+	}
+	res.addSchedulerResult(<-schedulerResults)
+	res.setDuration(duration, cfg.Stages, cfg.Warmup)
+	return res, nil
+}
+
+type rateScheduler struct {
+	fetcher namesFetcher
+	seed    int64
+	// rate is the fixed arrival rate used when there is no load profile.
+	rate  int
+	start time.Time
+	// the requests due before warmupEnd are not accounted
+	warmupEnd time.Time
+	profile   *profile
+	live      *liveStats
+	tasks     chan<- rateTask
+	results   chan<- schedulerResult
+}
+
+// idleRateStep is how far the schedule is advanced while the target rate is zero.
+const idleRateStep = time.Millisecond * 10
+
+func (s *rateScheduler) rateAt(t time.Time) float64 {
+	if s.profile.stagesCount() == 0 {
+		return float64(s.rate)
+	}
+	return s.profile.targetAt(t)
+}
+
+// run emits requests at the target rate until the context is done.
+// If it falls behind the schedule (e.g. the timer fired late) it catches up
+// by emitting all the overdue requests at once.
+func (s *rateScheduler) run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer close(s.tasks)
+
+	res := newSchedulerResult(s.profile.stagesCount())
+	defer func() {
+		s.results <- res
+	}()
+
+	names := make([]common.Name, dispatcherBatchLen)
+	nameIdx := len(names)
+	var scheduled int64
+
+	next := s.start
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		now := time.Now()
+		for !next.After(now) {
+			intended := next
+			rate := s.rateAt(intended)
+			if rate <= 0 {
+				next = next.Add(idleRateStep)
+				continue
+			}
+			// above 1e9 rps the interval truncates to zero and the schedule would never advance
+			next = next.Add(max(time.Duration(float64(time.Second)/rate), time.Nanosecond))
+
+			if nameIdx == len(names) {
+				s.fetcher.GetNames(names)
+				nameIdx = 0
+			}
+			t := rateTask{
+				Name:     names[nameIdx],
+				Intended: intended,
+				Seed:     taskSeed(s.seed, scheduled),
+			}
+			nameIdx++
+			scheduled++
+
+			dropped := false
+			select {
+			case s.tasks <- t:
+			default:
+				dropped = true
+			}
+			s.live.requestScheduled(dropped)
+			if !intended.Before(s.warmupEnd) {
+				res.record(s.profile.stageAt(intended), dropped)
+			}
+		}
+		timer.Reset(next.Sub(now))
+	}
+}
+
+func rateWorker(
+	ctx context.Context,
+	wg *sync.WaitGroup,
+	env *testEnv,
+	tasks <-chan rateTask,
+	results chan<- workerResult,
+) {
+	defer wg.Done()
+	env.live.workerStarted()
+	defer env.live.workerStopped()
+
+	res := newWorkerResult(env.profile.stagesCount())
+	// the source is reseeded for every task
+	rnd := rand.New(rand.NewSource(env.seed))
+	defer func() {
+		results <- res
+	}()
+
+	for t := range tasks {
+		rnd.Seed(t.Seed)
+		res.do(ctx, env, env.mix.pick(rnd), t.Name, rnd, t.Intended)
+	}
+}
@@ -0,0 +1,81 @@
+package loadgen
+
+import (
+	"context"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+// stageControlInterval is how often the number of running workers is adjusted to the profile.
+const stageControlInterval = time.Millisecond * 100
+
+// runStagedGenerator is the closed-model generator which adds and removes workers
+// following the load profile.
+func runStagedGenerator(ctx context.Context, cfg Config, f namesFetcher, env *testEnv) (loadTestResult, error) {
+	stagesCount := len(cfg.Stages)
+
+	workerCtx, cancelWorkerCtx := context.WithTimeout(ctx, stagesDuration(cfg.Stages))
+	defer cancelWorkerCtx()
+
+	tasks := make(chan nameBatch, 1)
+	// workers come and go, so the results are collected concurrently instead of being buffered
+	results := make(chan workerResult)
+	collected := make(chan loadTestResult, 1)
+	go func() {
+		res := newLoadTestResult(stagesCount)
+		for r := range results {
+			res.addWorkerResult(r)
+		}
+		collected <- res
+	}()
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go dispatcher(workerCtx, wg, f, env.seed, tasks)
+
+	start := time.Now()
+	p := newProfile(cfg.Stages, start)
+	env = env.withProfile(p)
+	// the surplus workers are stopped between the requests, so that a ramp-down does not abort them
+	var stopWorkers []chan struct{}
+	currentStage := -1
+
+	ticker := time.NewTicker(stageControlInterval)
+	defer ticker.Stop()
+controlLoop:
+	for {
+		now := time.Now()
+		if stage := p.stageAt(now); stage != currentStage {
+			currentStage = stage
+			log.Printf("stage %d/%d: %v workers", stage+1, stagesCount, cfg.Stages[stage])
+		}
+
+		target := int(math.Round(p.targetAt(now)))
+		for len(stopWorkers) < target {
+			stop := make(chan struct{})
+			stopWorkers = append(stopWorkers, stop)
+			wg.Add(1)
+			go worker(workerCtx, stop, wg, env, tasks, results)
+		}
+		for len(stopWorkers) > target {
+			last := len(stopWorkers) - 1
+			close(stopWorkers[last])
+			stopWorkers = stopWorkers[:last]
+		}
+
+		select {
+		case <-workerCtx.Done():
+			break controlLoop
+		case <-ticker.C:
+		}
+	}
+	wg.Wait()
+	duration := time.Since(start)
+	close(results)
+
+	res := <-collected
+	res.setDuration(duration, cfg.Stages, 0)
+	return res, nil
+}
@@ -0,0 +1,75 @@
+package loadgen
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRunStagedGenerator(t *testing.T) {
+	srv := newScriptedServer(scriptedResponse{http.StatusNotFound, time.Millisecond})
+	defer srv.Close()
+
+	cfg := newTestConfig(srv.URL)
+	cfg.Stages = []Stage{
+		{Duration: 200 * time.Millisecond, From: 1, To: 1},
+		{Duration: 200 * time.Millisecond, From: 4, To: 4},
+	}
+	env, err := newTestEnv(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := runStagedGenerator(context.Background(), cfg, &fakeNames{}, env)
+	env.close()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(res.Stages) != len(cfg.Stages) {
+		t.Fatalf("got %d stage results, want %d", len(res.Stages), len(cfg.Stages))
+	}
+	var ops int64
+	var duration time.Duration
+	for i, s := range res.Stages {
+		if s.Ops == 0 {
+			t.Errorf("stage #%d has no ops", i+1)
+		}
+		ops += s.Ops
+		duration += s.Duration
+	}
+	if ops != res.Ops {
+		t.Errorf("the stages have %d ops, want the total %d", ops, res.Ops)
+	}
+	if res.Stages[0].Duration != cfg.Stages[0].Duration || duration != res.Duration {
+		t.Errorf("stage durations %v and %v, want %v and the total %v",
+			res.Stages[0].Duration, res.Stages[1].Duration, cfg.Stages[0].Duration, res.Duration)
+	}
+}
+
+func TestRunStagedGeneratorRampDown(t *testing.T) {
+	srv := newScriptedServer(scriptedResponse{http.StatusNotFound, 30 * time.Millisecond})
+	defer srv.Close()
+
+	cfg := newTestConfig(srv.URL)
+	cfg.Stages = []Stage{
+		{Duration: 150 * time.Millisecond, From: 4, To: 4},
+		{Duration: 150 * time.Millisecond, From: 1, To: 1},
+	}
+	env, err := newTestEnv(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := runStagedGenerator(context.Background(), cfg, &fakeNames{}, env)
+	env.close()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the workers removed by the ramp-down finish their requests, only the ones
+	// running at the end of the test may be cancelled
+	if res.Stages[0].Cancelled > 0 || res.Cancelled > 1 {
+		t.Errorf("%d requests cancelled in the first stage, %d in total; want none and at most 1",
+			res.Stages[0].Cancelled, res.Cancelled)
+	}
+}
@@ -0,0 +1,341 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"loadgen/internal/common"
+)
+
+// The conformance suite checks the implementations of the generator against the spec in the README.
+// It targets the README signature, readmeGenerator: the solution has to send the lookups
+// to cfg.HTTP.TargetURL+cfg.HTTP.EmailEndpoint and log the unexpected status codes with the message
+// of unexpectedStatusError, as runGeneratorNominal does. To check a solution, add it to generatorImpls.
+// Run the suite with the race detector:
+//
+//	go test -race -run TestGeneratorConformance ./internal/loadgen
+
+// readmeGenerator is the signature of the generator the README asks to implement.
+type readmeGenerator func(ctx context.Context, cfg Config, f namesFetcher) (loadTestResult, error)
+
+type generatorImpl struct {
+	name string
+	run  readmeGenerator
+}
+
+var generatorImpls = []generatorImpl{
+	{name: ImplDispatcher, run: withTestEnv(runGenerator)},
+	{
+		name: ImplNominal,
+		run: withTestEnv(func(ctx context.Context, cfg Config, f namesFetcher, env *testEnv) (loadTestResult, error) {
+			return runGeneratorNominal(ctx, cfg, f, env.driver, env.live, env.errLog)
+		}),
+	},
+}
+
+// withTestEnv adapts the generators of the repo, which share the test environment, to the README signature.
+func withTestEnv(
+	run func(ctx context.Context, cfg Config, f namesFetcher, env *testEnv) (loadTestResult, error),
+) readmeGenerator {
+	return func(ctx context.Context, cfg Config, f namesFetcher) (loadTestResult, error) {
+		env, err := newTestEnv(ctx, cfg)
+		if err != nil {
+			return loadTestResult{}, err
+		}
+		defer env.close()
+		return run(ctx, cfg, f, env)
+	}
+}
+
+// fakeNames hands out the names of a single fake employee, so that every email
+// sent by the generator can be traced back to the fetcher.
+type fakeNames struct {
+	batches atomic.Int64
+}
+
+const (
+	fakeFirstName = "Conformance"
+	fakeLastName  = "Gopher"
+)
+
+func (f *fakeNames) GetNames(dst []common.Name) {
+	f.batches.Add(1)
+	for i := range dst {
+		dst[i] = common.Name{FirstName: fakeFirstName, LastName: fakeLastName}
+	}
+}
+
+type scriptedResponse struct {
+	code    int
+	latency time.Duration
+}
+
+// scriptedServer answers the employee-by-email requests with the responses of the script in turn.
+type scriptedServer struct {
+	*httptest.Server
+	script  []scriptedResponse
+	next    atomic.Int64
+	mux     sync.Mutex
+	served  map[int]int64
+	foreign []string
+}
+
+func newScriptedServer(script ...scriptedResponse) *scriptedServer {
+	s := &scriptedServer{script: script, served: make(map[int]int64)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+func (s *scriptedServer) handle(w http.ResponseWriter, r *http.Request) {
+	resp := s.script[(s.next.Add(1)-1)%int64(len(s.script))]
+	select {
+	case <-time.After(resp.latency):
+	case <-r.Context().Done():
+		return
+	}
+	s.mux.Lock()
+	// the response is counted before it is sent, so the client can never see more than served
+	s.served[resp.code]++
+	if email := strings.TrimPrefix(r.URL.Path, "/employee-by-email/"); email != emailFromName(
+		common.Name{FirstName: fakeFirstName, LastName: fakeLastName},
+	) {
+		s.foreign = append(s.foreign, r.URL.Path)
+	}
+	s.mux.Unlock()
+	w.WriteHeader(resp.code)
+}
+
+// stopBound is how long the generator may keep running after the test should have ended.
+const stopBound = 300 * time.Millisecond
+
+func TestGeneratorConformance(t *testing.T) {
+	cases := []struct {
+		name     string
+		script   []scriptedResponse
+		duration time.Duration
+		// interruptAfter cancels the parent context before the end of the test
+		interruptAfter time.Duration
+	}{
+		{
+			name: "mixed",
+			script: []scriptedResponse{
+				{http.StatusOK, time.Millisecond},
+				{http.StatusNotFound, 2 * time.Millisecond},
+				{http.StatusInternalServerError, time.Millisecond},
+				{http.StatusOK, 0},
+			},
+			duration: 300 * time.Millisecond,
+		},
+		{
+			name:     "slow responses",
+			script:   []scriptedResponse{{http.StatusOK, 5 * time.Second}},
+			duration: 200 * time.Millisecond,
+		},
+		{
+			name:           "interrupted",
+			script:         []scriptedResponse{{http.StatusNotFound, time.Millisecond}},
+			duration:       time.Minute,
+			interruptAfter: 200 * time.Millisecond,
+		},
+	}
+	for _, impl := range generatorImpls {
+		for _, c := range cases {
+			t.Run(impl.name+"/"+c.name, func(t *testing.T) {
+				testConformance(t, impl, c.script, c.duration, c.interruptAfter)
+			})
+		}
+	}
+}
+
+func testConformance(
+	t *testing.T,
+	impl generatorImpl,
+	script []scriptedResponse,
+	duration, interruptAfter time.Duration,
+) {
+	goroutines := runtime.NumGoroutine()
+	srv := newScriptedServer(script...)
+	defer srv.Close()
+
+	logs := &bytes.Buffer{}
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(logs)
+
+	cfg := newTestConfig(srv.URL)
+	cfg.Duration = duration
+	// every error is logged to be checked against the result
+	cfg.ErrorLogRate = 1 << 20
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f := &fakeNames{}
+
+	runFor := duration
+	if interruptAfter > 0 {
+		runFor = interruptAfter
+		defer time.AfterFunc(interruptAfter, cancel).Stop()
+	}
+	start := time.Now()
+	res, err := impl.run(ctx, cfg, f)
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if elapsed > runFor+stopBound {
+		t.Errorf("the generator has stopped in %v, want at most %v", elapsed, runFor+stopBound)
+	}
+	if f.batches.Load() == 0 {
+		t.Errorf("the names fetcher has not been used")
+	}
+
+	srv.Close()
+	srv.mux.Lock()
+	served := srv.served
+	foreign := srv.foreign
+	srv.mux.Unlock()
+	if len(foreign) > 0 {
+		t.Errorf("%d requests are not for the fetched names, e.g. %s", len(foreign), foreign[0])
+	}
+	var total int64
+	for _, n := range served {
+		total += n
+	}
+	logged := int64(strings.Count(logs.String(), "an unexpected status code received: 500"))
+	if ok := served[http.StatusOK] + served[http.StatusNotFound]; res.Ops > ok {
+		t.Errorf("ops %d, but only %d responses with 200 and 404 served: %v", res.Ops, ok, served)
+	}
+	if logged > served[http.StatusInternalServerError] {
+		t.Errorf("%d errors logged, but only %d responses with 500 served", logged, served[http.StatusInternalServerError])
+	}
+	// only the requests in flight at the end may be neither counted nor logged
+	if lost := total - res.Ops - logged; lost > int64(cfg.WorkersCount) {
+		t.Errorf("%d of %d responses neither counted as ops nor logged as errors", lost, total)
+	}
+
+	// the implementations of the repo also break the results down by the status code
+	if codes := res.StatusCodes; codes != nil {
+		if res.Ops != codes[http.StatusOK]+codes[http.StatusNotFound] {
+			t.Errorf("ops %d, want only the 200 and 404 responses counted: %v", res.Ops, codes)
+		}
+		if res.Errors != codes[http.StatusInternalServerError] || res.Errors != logged {
+			t.Errorf("errors %d, logged %d, want the 500 responses: %v", res.Errors, logged, codes)
+		}
+		if res.Latency.Count() != res.Ops {
+			t.Errorf("latency has %d samples, want one per op %d", res.Latency.Count(), res.Ops)
+		}
+		if res.Cancelled > int64(cfg.WorkersCount) {
+			t.Errorf("%d requests cancelled, want at most one per worker", res.Cancelled)
+		}
+	}
+
+	checkGoroutines(t, goroutines)
+}
+
+// newTestConfig returns the config of a test against the target with 4 workers.
+func newTestConfig(target string) Config {
+	return Config{
+		WorkersCount: 4,
+		Seed:         1,
+		HTTP: HTTPConfig{
+			TargetURL:     target,
+			EmailEndpoint: "/employee-by-email/",
+			Timeout:       10 * time.Second,
+		},
+	}
+}
+
+// checkGoroutines waits for the goroutines started by the test to exit.
+func checkGoroutines(t *testing.T, before int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			buf = buf[:runtime.Stack(buf, true)]
+			t.Errorf("%d goroutines leaked:\n%s", runtime.NumGoroutine()-before, buf)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// seqNames hands out the distinct names in sequence.
+type seqNames struct {
+	next atomic.Int64
+}
+
+func (f *seqNames) GetNames(dst []common.Name) {
+	for i := range dst {
+		dst[i] = common.Name{FirstName: strconv.FormatInt(f.next.Add(1), 10), LastName: fakeLastName}
+	}
+}
+
+func TestSeedReproducible(t *testing.T) {
+	for _, mode := range []string{"workers", "rate"} {
+		t.Run(mode, func(t *testing.T) {
+			run := func() map[string]string {
+				mux := &sync.Mutex{}
+				bodies := make(map[string]string)
+				srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					var e struct {
+						FirstName string `json:"first_name"`
+					}
+					b, _ := io.ReadAll(r.Body)
+					_ = json.Unmarshal(b, &e)
+					mux.Lock()
+					bodies[e.FirstName] = string(b)
+					mux.Unlock()
+					w.WriteHeader(http.StatusCreated)
+				}))
+				defer srv.Close()
+
+				cfg := newTestConfig(srv.URL)
+				cfg.Duration = 200 * time.Millisecond
+				cfg.HTTP.EmployeeEndpoint = "/employee"
+				cfg.Requests = DefaultRequests([]OpWeight{{OpWrites, 1}}, cfg.HTTP)
+				run := runGenerator
+				if mode == "rate" {
+					cfg.Rate = 2000
+					run = runRateGenerator
+				}
+				env, err := newTestEnv(context.Background(), cfg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer env.close()
+				if _, err := run(context.Background(), cfg, &seqNames{}, env); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				mux.Lock()
+				defer mux.Unlock()
+				return bodies
+			}
+
+			first, second := run(), run()
+			same := 0
+			for name, b := range first {
+				if sb, ok := second[name]; ok {
+					if sb != b {
+						t.Fatalf("the requests for the name %s differ between the runs:\n%s\n%s", name, b, sb)
+					}
+					same++
+				}
+			}
+			if same < 100 {
+				t.Errorf("only %d names are requested in both runs", same)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package loadgen
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+
+	"loadgen/internal/common"
+)
+
+type KeysConfig struct {
+	// KnownEmailsFile is a file with one existing email per line, e.g. written by datagen.
+	KnownEmailsFile string
+	// KnownEmailsDSN is a database the known emails are sampled from if there is no file.
+	KnownEmailsDSN string
+	// KnownEmailsLimit is the max number of emails sampled from the database.
+	KnownEmailsLimit int
+	// HitRatio is the share of the lookups which use a known email, the rest are guaranteed misses.
+	// It only takes effect with a known emails source.
+	HitRatio float64
+	// Distribution is how the keys are chosen. Without the known emails setting it makes
+	// the lookups use a fixed key space of KeySpace emails derived from random names.
+	Distribution KeyDistribution
+	KeySpace     int
+}
+
+func (c KeysConfig) hasKnownEmails() bool {
+	return c.KnownEmailsFile != "" || c.KnownEmailsDSN != ""
+}
+
+// emailSource picks the emails for the requests from a fixed key space. Without it the email
+// is derived from the dispatched name, so whether it exists depends on the dataset.
+type emailSource struct {
+	keys []string
+	// known is set if the keys are existing emails, only then the misses are generated.
+	known    bool
+	hitRatio float64
+	dist     KeyDistribution
+	chooser  keyChooser
+}
+
+func newEmailSource(ctx context.Context, cfg KeysConfig, f namesFetcher) (*emailSource, error) {
+	s := &emailSource{
+		hitRatio: 1,
+		dist:     cfg.Distribution,
+	}
+	var err error
+	switch {
+	case cfg.KnownEmailsFile != "":
+		s.keys, err = readKnownEmails(cfg.KnownEmailsFile)
+	case cfg.KnownEmailsDSN != "":
+		s.keys, err = sampleKnownEmails(ctx, cfg.KnownEmailsDSN, cfg.KnownEmailsLimit)
+	case cfg.Distribution.Kind != "":
+		s.keys = nameEmails(f, cfg.KeySpace)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the known emails: %w", err)
+	}
+	if len(s.keys) == 0 {
+		return nil, fmt.Errorf("no known emails found")
+	}
+	if cfg.hasKnownEmails() {
+		s.known = true
+		s.hitRatio = cfg.HitRatio
+	}
+	if s.dist.Kind == "" {
+		s.dist.Kind = DistUniform
+	}
+	s.chooser = newKeyChooser(s.dist, len(s.keys))
+	return s, nil
+}
+
+// nameEmails derives up to n distinct emails from random names.
+func nameEmails(f namesFetcher, n int) []string {
+	names := make([]common.Name, n)
+	f.GetNames(names)
+	seen := make(map[string]struct{}, n)
+	emails := make([]string, 0, n)
+	for _, name := range names {
+		e := emailFromName(name)
+		if _, ok := seen[e]; !ok {
+			seen[e] = struct{}{}
+			emails = append(emails, e)
+		}
+	}
+	return emails
+}
+
+// pick returns the email to look up and the index of its key, the index is -1 for
+// the misses and the emails derived from the name.
+func (s *emailSource) pick(rnd *rand.Rand, n common.Name) (string, int) {
+	if s == nil {
+		return emailFromName(n), -1
+	}
+	if s.known && rnd.Float64() >= s.hitRatio {
+		return missEmail(n, rnd), -1
+	}
+	idx := s.chooser.next(rnd)
+	return s.keys[idx], idx
+}
+
+// stats returns the realised distribution of the keys from the numbers of the requests by the key index.
+func (s *emailSource) stats(requests map[int]int64) *keyStats {
+	if s == nil {
+		return nil
+	}
+	counts := make([]int64, len(s.keys))
+	for idx, n := range requests {
+		counts[idx] = n
+	}
+	ks := newKeyStats(s.dist.String(), counts)
+	return &ks
+}
+
+// missEmail returns an email which cannot exist: datagen never adds a suffix to the name.
+func missEmail(n common.Name, rnd *rand.Rand) string {
+	return fmt.Sprintf("%s.%s+miss%d@gopher-corp.com", n.FirstName, n.LastName, rnd.Int63())
+}
+
+func readKnownEmails(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the known emails file: %w", err)
+	}
+	defer f.Close()
+
+	var emails []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if e := strings.TrimSpace(s.Text()); e != "" {
+			emails = append(emails, e)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read the known emails file: %w", err)
+	}
+	return emails, nil
+}
+
+func sampleKnownEmails(ctx context.Context, dsn string, limit int) ([]string, error) {
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the DB: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	// ORDER BY random() would sort the whole table, so random pages are sampled instead.
+	// The share of the pages is estimated from the table statistics with a margin for
+	// the sampling variance and the employees without an email.
+	var tableRows float64
+	err = conn.QueryRow(ctx, `SELECT reltuples FROM pg_class WHERE oid = 'employees'::regclass`).Scan(&tableRows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to estimate the number of employees: %w", err)
+	}
+	percent := 100.0
+	if tableRows > 0 {
+		percent = min(100, float64(limit)*2/tableRows*100)
+	}
+	rows, err := conn.Query(
+		ctx,
+		`SELECT email FROM employees TABLESAMPLE SYSTEM ($1) WHERE email IS NOT NULL LIMIT $2`,
+		percent, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample the known emails: %w", err)
+	}
+	emails, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan the known emails: %w", err)
+	}
+	return emails, nil
+}
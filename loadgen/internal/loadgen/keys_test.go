@@ -0,0 +1,78 @@
+package loadgen
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"loadgen/internal/common"
+)
+
+func TestEmailSourceOnlyForLookups(t *testing.T) {
+	const known = "known@gopher-corp.com"
+	file := filepath.Join(t.TempDir(), "emails.txt")
+	if err := os.WriteFile(file, []byte(known+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	emails, err := newEmailSource(context.Background(), KeysConfig{KnownEmailsFile: file, HitRatio: 1}, &fakeNames{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := &sync.Mutex{}
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mux.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+string(body))
+		mux.Unlock()
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	cfg := newTestConfig(srv.URL)
+	cfg.HTTP.EmployeeEndpoint = "/employee"
+	c, err := newClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	m, err := newMix(DefaultRequests([]OpWeight{{OpReads, 1}, {OpWrites, 1}}, cfg.HTTP), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := common.Name{FirstName: "Ada", LastName: "Gopher"}
+	rnd := rand.New(rand.NewSource(1))
+	keys := make(map[string]int)
+	for _, op := range m.ops {
+		vars := newRequestVars(n, rnd, nil, emails)
+		if _, err := op.do(context.Background(), c, vars); err != nil {
+			t.Fatalf("%s: %v", op.name(), err)
+		}
+		keys[op.name()] = vars.lookupKey
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(requests))
+	}
+	if !strings.HasPrefix(requests[0], "GET /employee-by-email/"+known) {
+		t.Errorf("the lookup should use the known email, got %q", requests[0])
+	}
+	if !strings.HasPrefix(requests[1], "POST /employee ") || !strings.Contains(requests[1], emailFromName(n)) {
+		t.Errorf("the write should use the email of the name, got %q", requests[1])
+	}
+	if keys[OpReads] != 0 || keys[OpWrites] != -1 {
+		t.Errorf("the picked keys are %v, want only the lookup to take a key", keys)
+	}
+}
@@ -0,0 +1,191 @@
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"loadgen/internal/stats"
+)
+
+// liveStats is updated by the workers with atomic operations only,
+// so that it can be read while the test is running without slowing the workers down.
+// All the methods are no-op for a nil liveStats.
+type liveStats struct {
+	ops           atomic.Int64
+	errors        atomic.Int64
+	inFlight      atomic.Int64
+	activeWorkers atomic.Int64
+	latency       *stats.AtomicHistogram
+	// latencySum is the total latency of the successful requests in nanoseconds.
+	latencySum atomic.Int64
+	// requests counts the completed requests by the requestKey.
+	requests sync.Map
+	// scheduled and dropped are only updated in the constant arrival rate mode.
+	scheduled atomic.Int64
+	dropped   atomic.Int64
+}
+
+// requestKey is the operation and the status code of a request, the code is zero if there was no response.
+type requestKey struct {
+	Op   string
+	Code int
+}
+
+func newLiveStats() *liveStats {
+	return &liveStats{
+		latency: stats.NewAtomicHistogram(),
+	}
+}
+
+func (s *liveStats) requestStarted() {
+	if s == nil {
+		return
+	}
+	s.inFlight.Add(1)
+}
+
+func (s *liveStats) requestFinished(op string, code int, latency time.Duration, err error) {
+	if s == nil {
+		return
+	}
+	s.inFlight.Add(-1)
+	k := requestKey{Op: op, Code: code}
+	n, ok := s.requests.Load(k)
+	if !ok {
+		n, _ = s.requests.LoadOrStore(k, &atomic.Int64{})
+	}
+	n.(*atomic.Int64).Add(1)
+	if err != nil {
+		s.errors.Add(1)
+		return
+	}
+	s.ops.Add(1)
+	s.latency.Record(latency)
+	s.latencySum.Add(int64(latency))
+}
+
+func (s *liveStats) requestScheduled(dropped bool) {
+	if s == nil {
+		return
+	}
+	s.scheduled.Add(1)
+	if dropped {
+		s.dropped.Add(1)
+	}
+}
+
+func (s *liveStats) requestCancelled() {
+	if s == nil {
+		return
+	}
+	s.inFlight.Add(-1)
+}
+
+func (s *liveStats) workerStarted() {
+	if s == nil {
+		return
+	}
+	s.activeWorkers.Add(1)
+}
+
+func (s *liveStats) workerStopped() {
+	if s == nil {
+		return
+	}
+	s.activeWorkers.Add(-1)
+}
+
+type liveSnapshot struct {
+	At            time.Time
+	Ops           int64
+	Errors        int64
+	InFlight      int64
+	ActiveWorkers int64
+	Latency       *stats.Histogram
+}
+
+func (s *liveStats) snapshot() liveSnapshot {
+	return liveSnapshot{
+		At:            time.Now(),
+		Ops:           s.ops.Load(),
+		Errors:        s.errors.Load(),
+		InFlight:      s.inFlight.Load(),
+		ActiveWorkers: s.activeWorkers.Load(),
+		Latency:       s.latency.Snapshot(),
+	}
+}
+
+// liveSource provides the cumulative live statistics, e.g. of the local workers or of all the agents.
+type liveSource interface {
+	snapshot() liveSnapshot
+}
+
+// progressReporter prints the statistics of every interval while the test is running.
+type progressReporter struct {
+	stats    liveSource
+	interval time.Duration
+	// tty makes the reporter redraw a single line instead of logging a line per interval.
+	tty bool
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// run reports the progress until the context is done.
+func (p *progressReporter) run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	start := time.Now()
+	prev := liveSnapshot{At: start}
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if p.tty {
+				fmt.Fprintln(os.Stdout)
+			}
+			return
+		case <-ticker.C:
+		}
+
+		cur := p.stats.snapshot()
+		line := formatProgress(cur.At.Sub(start), prev, cur)
+		if p.tty {
+			fmt.Fprintf(os.Stdout, "\r\033[K%s", line)
+		} else {
+			log.Print(line)
+		}
+		prev = cur
+	}
+}
+
+func formatProgress(elapsed time.Duration, prev, cur liveSnapshot) string {
+	ops := cur.Ops - prev.Ops
+	errs := cur.Errors - prev.Errors
+	// the failed requests are sent too, otherwise an error storm would look like a throughput collapse
+	rps := 0.0
+	if d := cur.At.Sub(prev.At).Seconds(); d > 0 {
+		rps = float64(ops+errs) / d
+	}
+	errRate := 0.0
+	if ops+errs > 0 {
+		errRate = float64(errs) / float64(ops+errs) * 100
+	}
+	interval := cur.Latency.Sub(prev.Latency)
+	return fmt.Sprintf(
+		"elapsed %v | rps %.1f | in-flight %d | workers %d | errors %.2f%% | p50 %v | p99 %v | ops %d",
+		elapsed.Round(time.Second), rps, cur.InFlight, cur.ActiveWorkers, errRate,
+		interval.Quantile(0.5), interval.Quantile(0.99), cur.Ops,
+	)
+}
@@ -0,0 +1,20 @@
+package loadgen
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"loadgen/internal/stats"
+)
+
+func TestFormatProgress(t *testing.T) {
+	start := time.Now()
+	prev := liveSnapshot{At: start, Latency: stats.NewHistogram()}
+	cur := liveSnapshot{At: start.Add(time.Second), Ops: 10, Errors: 90, Latency: stats.NewHistogram()}
+	line := formatProgress(time.Second, prev, cur)
+	// the failed requests are sent at the same rate as the successful ones
+	if !strings.Contains(line, "rps 100.0") || !strings.Contains(line, "errors 90.00%") {
+		t.Errorf("unexpected progress line: %s", line)
+	}
+}
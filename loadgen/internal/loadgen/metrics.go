@@ -0,0 +1,120 @@
+package loadgen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are the upper bounds of the exported latency histogram buckets, in seconds.
+var latencyBuckets = []float64{
+	0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10,
+}
+
+// startMetrics serves the live statistics in the Prometheus text format on /metrics,
+// the returned function stops the server.
+func startMetrics(cfg Config, live *liveStats) (func(), error) {
+	if cfg.MetricsAddr == "" {
+		return func() {}, nil
+	}
+	ln, err := net.Listen("tcp", cfg.MetricsAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", cfg.MetricsAddr, err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := writeMetrics(w, live); err != nil {
+			log.Printf("failed to write the metrics: %v", err)
+		}
+	})
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("metrics server has failed: %v", err)
+		}
+	}()
+	log.Printf("serving the metrics on http://%s/metrics", ln.Addr())
+	return func() { _ = srv.Close() }, nil
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeMetrics(w io.Writer, s *liveStats) error {
+	b := &bytes.Buffer{}
+	metric := func(name, typ, help string) {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+
+	metric(
+		"loadgen_requests_total", "counter",
+		`Completed requests by operation and status code, the status is "none" if there was no response.`,
+	)
+	type request struct {
+		key requestKey
+		n   int64
+	}
+	var requests []request
+	s.requests.Range(func(k, v any) bool {
+		requests = append(requests, request{key: k.(requestKey), n: v.(*atomic.Int64).Load()})
+		return true
+	})
+	sort.Slice(requests, func(i, j int) bool {
+		if requests[i].key.Op != requests[j].key.Op {
+			return requests[i].key.Op < requests[j].key.Op
+		}
+		return requests[i].key.Code < requests[j].key.Code
+	})
+	for _, r := range requests {
+		status := "none"
+		if r.key.Code != 0 {
+			status = strconv.Itoa(r.key.Code)
+		}
+		fmt.Fprintf(b, "loadgen_requests_total{op=\"%s\",status=\"%s\"} %d\n", labelEscaper.Replace(r.key.Op), status, r.n)
+	}
+
+	metric("loadgen_request_errors_total", "counter", "Failed requests, including the unexpected status codes.")
+	fmt.Fprintf(b, "loadgen_request_errors_total %d\n", s.errors.Load())
+
+	metric("loadgen_request_duration_seconds", "histogram", "Latency of the successful requests.")
+	h := s.latency.Snapshot()
+	for _, le := range latencyBuckets {
+		// the values sharing the bucket with the bound are counted as above it, le is an upper bound
+		n := h.CountAtMost(time.Duration(le * float64(time.Second)))
+		fmt.Fprintf(b, "loadgen_request_duration_seconds_bucket{le=\"%s\"} %d\n", formatFloat(le), n)
+	}
+	fmt.Fprintf(b, "loadgen_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", h.Count())
+	fmt.Fprintf(b, "loadgen_request_duration_seconds_sum %s\n", formatFloat(time.Duration(s.latencySum.Load()).Seconds()))
+	fmt.Fprintf(b, "loadgen_request_duration_seconds_count %d\n", h.Count())
+
+	metric("loadgen_requests_in_flight", "gauge", "Requests sent and not yet completed.")
+	fmt.Fprintf(b, "loadgen_requests_in_flight %d\n", s.inFlight.Load())
+	metric("loadgen_active_workers", "gauge", "Running workers.")
+	fmt.Fprintf(b, "loadgen_active_workers %d\n", s.activeWorkers.Load())
+	metric("loadgen_requests_scheduled_total", "counter", "Requests due in the constant arrival rate mode.")
+	fmt.Fprintf(b, "loadgen_requests_scheduled_total %d\n", s.scheduled.Load())
+	metric(
+		"loadgen_requests_dropped_total", "counter",
+		"Requests due while no worker was free in the constant arrival rate mode.",
+	)
+	fmt.Fprintf(b, "loadgen_requests_dropped_total %d\n", s.dropped.Load())
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
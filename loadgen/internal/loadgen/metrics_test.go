@@ -0,0 +1,52 @@
+package loadgen
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	s := newLiveStats()
+	for i := 0; i < 3; i++ {
+		s.requestStarted()
+		s.requestFinished(OpReads, http.StatusOK, 2*time.Millisecond, nil)
+	}
+	// 2.51ms shares the histogram bucket with 2.5ms, it should not get into le="0.0025"
+	s.requestStarted()
+	s.requestFinished(OpReads, http.StatusOK, 2510*time.Microsecond, nil)
+	s.requestStarted()
+	s.requestFinished(OpReads, http.StatusInternalServerError, time.Millisecond, &unexpectedStatusError{Code: 500})
+	s.requestStarted()
+	s.requestFinished(`w"rites`, 0, time.Millisecond, errors.New("connection refused"))
+	s.requestStarted()
+	s.requestScheduled(false)
+	s.requestScheduled(true)
+
+	b := &strings.Builder{}
+	if err := writeMetrics(b, s); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`loadgen_requests_total{op="reads",status="200"} 4`,
+		`loadgen_requests_total{op="reads",status="500"} 1`,
+		`loadgen_requests_total{op="w\"rites",status="none"} 1`,
+		"loadgen_request_errors_total 2",
+		`loadgen_request_duration_seconds_bucket{le="0.001"} 0`,
+		`loadgen_request_duration_seconds_bucket{le="0.0025"} 3`,
+		`loadgen_request_duration_seconds_bucket{le="0.005"} 4`,
+		`loadgen_request_duration_seconds_bucket{le="+Inf"} 4`,
+		"loadgen_request_duration_seconds_sum 0.00851",
+		"loadgen_request_duration_seconds_count 4",
+		"loadgen_requests_in_flight 1",
+		"loadgen_requests_scheduled_total 2",
+		"loadgen_requests_dropped_total 1",
+		"# TYPE loadgen_request_duration_seconds histogram",
+	} {
+		if !strings.Contains(b.String(), want+"\n") {
+			t.Errorf("no %q in the metrics:\n%s", want, b)
+		}
+	}
+}
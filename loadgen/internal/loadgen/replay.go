@@ -0,0 +1,416 @@
+package loadgen
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"loadgen/internal/report"
+	"loadgen/internal/stats"
+)
+
+const (
+	ReplayFormatAuto   = "auto"
+	ReplayFormatAccess = "access"
+	ReplayFormatNDJSON = "ndjson"
+)
+
+// ReplayConfig describes the replay of a request log.
+type ReplayConfig struct {
+	LogFile string
+	// Format is the format of the log, the auto format is detected by the first line.
+	Format string
+	// Speed multiplies the pace of the log: 1 preserves the relative timing, 2 replays it twice as fast,
+	// 0 sends the requests as fast as MaxInFlight allows.
+	Speed float64
+	// MaxInFlight limits the concurrent requests, the requests due while it is reached are sent late.
+	MaxInFlight int
+	// ProgressInterval is how often the live statistics are printed, zero disables them.
+	ProgressInterval time.Duration
+	HTTP             HTTPConfig
+}
+
+// logEntry is a request read from the log.
+type logEntry struct {
+	Time   time.Time
+	Method string
+	Path   string
+	Body   []byte
+	// Status and Duration describe the logged response, they are zero if the log does not have them.
+	Status   int
+	Duration time.Duration
+}
+
+// endpoint groups the requests by the method and the first path segment, e.g. "GET /employee-by-email".
+func (e logEntry) endpoint() string {
+	p := strings.TrimPrefix(e.Path, "/")
+	p, _, _ = strings.Cut(p, "?")
+	p, _, _ = strings.Cut(p, "/")
+	return e.Method + " /" + p
+}
+
+// ndjsonEntry is a line of the NDJSON log.
+type ndjsonEntry struct {
+	Timestamp time.Time `json:"timestamp"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Body      string    `json:"body"`
+	// Status and DurationMs are optional.
+	Status     int     `json:"status"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// bodyMethods are the methods of the requests which cannot be replayed from the access log:
+// it has no request bodies.
+var bodyMethods = map[string]bool{
+	http.MethodPost:  true,
+	http.MethodPut:   true,
+	http.MethodPatch: true,
+}
+
+// readReplayLog reads the requests of the log, skipped is the number of the access log
+// requests skipped because their bodies are unknown.
+func readReplayLog(path, format string) (entries []logEntry, skipped int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open the log: %w", err)
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		if format == ReplayFormatAuto {
+			format = ReplayFormatAccess
+			if strings.HasPrefix(line, "{") {
+				format = ReplayFormatNDJSON
+			}
+		}
+		var (
+			e  logEntry
+			ok bool
+		)
+		if format == ReplayFormatNDJSON {
+			e, err = parseNDJSONLine(line)
+			ok = err == nil
+		} else {
+			e, ok, err = parseAccessLine(line)
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("line %d: %w", n, err)
+		}
+		if ok && format == ReplayFormatAccess && bodyMethods[e.Method] {
+			skipped++
+			continue
+		}
+		if ok {
+			entries = append(entries, e)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read the log: %w", err)
+	}
+	// the access log lines are written when the responses are sent, not in the order of the requests
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	return entries, skipped, nil
+}
+
+func parseNDJSONLine(line string) (logEntry, error) {
+	var j ndjsonEntry
+	if err := json.Unmarshal([]byte(line), &j); err != nil {
+		return logEntry{}, fmt.Errorf("failed to parse the JSON: %w", err)
+	}
+	if j.Timestamp.IsZero() || j.Path == "" {
+		return logEntry{}, fmt.Errorf("timestamp and path are required")
+	}
+	e := logEntry{
+		Time:     j.Timestamp,
+		Method:   strings.ToUpper(j.Method),
+		Path:     j.Path,
+		Status:   j.Status,
+		Duration: time.Duration(j.DurationMs * float64(time.Millisecond)),
+	}
+	if e.Method == "" {
+		e.Method = http.MethodGet
+	}
+	if j.Body != "" {
+		e.Body = []byte(j.Body)
+	}
+	return e, nil
+}
+
+// parseAccessLine parses the access log line of the app, see the AccessLog middleware.
+// The other lines of the app log are skipped.
+func parseAccessLine(line string) (logEntry, bool, error) {
+	_, fields, ok := strings.Cut(line, "access ts=")
+	if !ok {
+		return logEntry{}, false, nil
+	}
+	var e logEntry
+	for i, f := range strings.Fields("ts=" + fields) {
+		k, v, ok := strings.Cut(f, "=")
+		if !ok {
+			return e, false, fmt.Errorf("field #%d: expected the key=value format, got %q", i+1, f)
+		}
+		var err error
+		switch k {
+		case "ts":
+			e.Time, err = time.Parse(time.RFC3339Nano, v)
+		case "method":
+			e.Method = v
+		case "path":
+			e.Path = v
+		case "status":
+			e.Status, err = strconv.Atoi(v)
+		case "duration":
+			e.Duration, err = time.ParseDuration(v)
+		}
+		if err != nil {
+			return e, false, fmt.Errorf("failed to parse the %s: %w", k, err)
+		}
+	}
+	if e.Method == "" || e.Path == "" {
+		return e, false, fmt.Errorf("method and path are required")
+	}
+	return e, true, nil
+}
+
+// replayOutcome is the result of a replayed request.
+type replayOutcome struct {
+	Status  int
+	Latency time.Duration
+	// Lag is how late the request has been sent relative to the schedule.
+	Lag       time.Duration
+	Err       error
+	Cancelled bool
+}
+
+// Replay sends the requests of the log and compares the responses with the logged ones.
+func Replay(ctx context.Context, rc ReplayConfig) error {
+	entries, skipped, err := readReplayLog(rc.LogFile, rc.Format)
+	if err != nil {
+		return err
+	}
+	if skipped > 0 {
+		log.Printf("skipped %d requests with a body: the access log has no bodies, replay them from NDJSON", skipped)
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("no requests found in the log")
+	}
+	span := entries[len(entries)-1].Time.Sub(entries[0].Time)
+	log.Printf("requests: %d, logged over %v, speed: %v", len(entries), span.Round(time.Millisecond), rc.Speed)
+
+	cfg := Config{
+		WorkersCount:     rc.MaxInFlight,
+		ProgressInterval: rc.ProgressInterval,
+		HTTP:             rc.HTTP,
+	}
+	c, err := newClient(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize the HTTP client: %w", err)
+	}
+	defer c.Close()
+	live := newLiveStats()
+	stopProgress := startProgress(ctx, cfg, live)
+	start := time.Now()
+	outcomes := replay(ctx, rc, c, live, entries)
+	elapsed := time.Since(start)
+	stopProgress()
+
+	printReplay(entries, outcomes, elapsed)
+	if ctx.Err() != nil {
+		log.Print("the replay has been interrupted, the results are partial")
+		return errInterrupted
+	}
+	return nil
+}
+
+func replay(
+	ctx context.Context,
+	rc ReplayConfig,
+	c *client,
+	live *liveStats,
+	entries []logEntry,
+) []replayOutcome {
+	outcomes := make([]replayOutcome, len(entries))
+	sem := make(chan struct{}, rc.MaxInFlight)
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	start := time.Now()
+	first := entries[0].Time
+	for i, e := range entries {
+		due := start
+		if rc.Speed > 0 {
+			due = start.Add(time.Duration(float64(e.Time.Sub(first)) / rc.Speed))
+		}
+		if !sleep(ctx, time.Until(due)) {
+			return outcomes[:i]
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return outcomes[:i]
+		}
+
+		wg.Add(1)
+		go func(e logEntry, out *replayOutcome) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			var headers http.Header
+			if e.Body != nil {
+				headers = http.Header{"Content-Type": {"application/json"}}
+			}
+			sent := time.Now()
+			out.Lag = sent.Sub(due)
+			live.requestStarted()
+			out.Status, out.Err = c.send(ctx, e.Method, e.Path, e.Body, headers, nil)
+			out.Latency = time.Since(sent)
+			if out.Err != nil && ctx.Err() != nil {
+				out.Cancelled = true
+				live.requestCancelled()
+				return
+			}
+			// the 4xx responses are a part of the logged traffic, e.g. the lookups of the missing emails,
+			// their changes are reported as the status mismatches
+			if out.Err == nil && out.Status >= http.StatusInternalServerError {
+				out.Err = &unexpectedStatusError{Code: out.Status}
+			}
+			live.requestFinished(e.endpoint(), out.Status, out.Latency, out.Err)
+		}(e, &outcomes[i])
+	}
+	return outcomes
+}
+
+// replayDeviation compares the replayed responses with the logged ones.
+type replayDeviation struct {
+	// Compared is the number of the requests with a logged status and a replayed response.
+	Compared int
+	// Mismatches counts the status changes by "logged->replayed".
+	Mismatches map[string]int
+	// Logged and Replayed hold the latencies of the requests with a logged duration.
+	Logged   *stats.Histogram
+	Replayed *stats.Histogram
+	// Ratios are the replayed to the logged latency ratios of the individual requests.
+	Ratios []float64
+}
+
+func newReplayDeviation() *replayDeviation {
+	return &replayDeviation{
+		Mismatches: make(map[string]int),
+		Logged:     stats.NewHistogram(),
+		Replayed:   stats.NewHistogram(),
+	}
+}
+
+func (d *replayDeviation) add(e logEntry, o replayOutcome) {
+	if o.Status == 0 || o.Cancelled {
+		return
+	}
+	if e.Status != 0 {
+		d.Compared++
+		if e.Status != o.Status {
+			d.Mismatches[fmt.Sprintf("%d->%d", e.Status, o.Status)]++
+		}
+	}
+	if e.Duration > 0 && o.Err == nil {
+		d.Logged.Record(e.Duration)
+		d.Replayed.Record(o.Latency)
+		d.Ratios = append(d.Ratios, float64(o.Latency)/float64(e.Duration))
+	}
+}
+
+func (d *replayDeviation) mismatches() int {
+	var n int
+	for _, c := range d.Mismatches {
+		n += c
+	}
+	return n
+}
+
+func printReplay(entries []logEntry, outcomes []replayOutcome, elapsed time.Duration) {
+	total := newWorkerResult(0)
+	lag := stats.NewHistogram()
+	totalDeviation := newReplayDeviation()
+	deviations := make(map[string]*replayDeviation)
+	for i, o := range outcomes {
+		e := entries[i]
+		if o.Cancelled {
+			total.recordCancelled(e.endpoint(), -1)
+			continue
+		}
+		total.record(e.endpoint(), -1, o.Status, o.Latency, o.Err)
+		lag.Record(o.Lag)
+		d, ok := deviations[e.endpoint()]
+		if !ok {
+			d = newReplayDeviation()
+			deviations[e.endpoint()] = d
+		}
+		d.add(e, o)
+		totalDeviation.add(e, o)
+	}
+	res := newLoadTestResult(0)
+	res.addWorkerResult(total)
+	res.setDuration(elapsed, nil, 0)
+
+	printStats("replay", res)
+	l := lag.Summary()
+	log.Printf("replay: schedule lag: p50 %v, p99 %v, max %v", l.P50, l.P99, l.Max)
+	if len(res.Operations) > 1 {
+		for _, ep := range report.SortedKeys(res.Operations) {
+			printStats(ep, *res.Operations[ep])
+		}
+	}
+	printDeviation("replay", totalDeviation)
+	if len(deviations) > 1 {
+		for _, ep := range report.SortedKeys(deviations) {
+			printDeviation(ep, deviations[ep])
+		}
+	}
+}
+
+func printDeviation(title string, d *replayDeviation) {
+	if d.Compared > 0 {
+		n := d.mismatches()
+		parts := make([]string, 0, len(d.Mismatches))
+		for _, change := range report.SortedKeys(d.Mismatches) {
+			parts = append(parts, fmt.Sprintf("%s: %d", change, d.Mismatches[change]))
+		}
+		msg := fmt.Sprintf(
+			"%s: status mismatches: %d of %d (%.2f%%)", title, n, d.Compared, float64(n)/float64(d.Compared)*100,
+		)
+		if n > 0 {
+			msg += ": " + strings.Join(parts, ", ")
+		}
+		log.Print(msg)
+	}
+	if len(d.Ratios) == 0 {
+		return
+	}
+	sort.Float64s(d.Ratios)
+	ratio := func(q float64) float64 {
+		return d.Ratios[min(int(q*float64(len(d.Ratios))), len(d.Ratios)-1)]
+	}
+	lg, rp := d.Logged.Summary(), d.Replayed.Summary()
+	log.Printf(
+		"%s: latency logged -> replayed: p50 %v -> %v, p90 %v -> %v, p99 %v -> %v",
+		title, lg.P50, rp.P50, lg.P90, rp.P90, lg.P99, rp.P99,
+	)
+	log.Printf(
+		"%s: replayed/logged latency ratio per request: p10 %.2f, p50 %.2f, p90 %.2f",
+		title, ratio(0.1), ratio(0.5), ratio(0.9),
+	)
+}
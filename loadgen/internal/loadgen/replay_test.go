@@ -0,0 +1,106 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadReplayLog(t *testing.T) {
+	dir := t.TempDir()
+	access := filepath.Join(dir, "access.log")
+	err := os.WriteFile(access, []byte(
+		"2024/05/01 10:00:00 access ts=2024-05-01T10:00:00.5Z method=GET path=/employee-by-email/b@x.com status=404 duration=2ms size=0\n"+
+			"2024/05/01 10:00:00 0b6a1c8e-7f2d-4c55-9a57-2b8f1e0c7d11\n"+
+			"2024/05/01 10:00:00 access ts=2024-05-01T10:00:00.1Z method=GET path=/employee-by-email/a@x.com status=200 duration=1.5ms size=99\n"+
+			"2024/05/01 10:00:00 access ts=2024-05-01T10:00:00.2Z method=POST path=/employee status=201 duration=3ms size=0\n",
+	), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, skipped, err := readReplayLog(access, ReplayFormatAuto)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 2 || skipped != 1 {
+		t.Fatalf("got %d entries and %d skipped, want 2 and the POST without a body skipped", len(entries), skipped)
+	}
+	if e := entries[0]; e.Path != "/employee-by-email/a@x.com" || e.Status != 200 || e.Duration != 1500*time.Microsecond {
+		t.Errorf("entries should be sorted by time, got %+v first", e)
+	}
+	if ep := entries[1].endpoint(); ep != "GET /employee-by-email" {
+		t.Errorf("endpoint is %q", ep)
+	}
+
+	ndjson := filepath.Join(dir, "requests.ndjson")
+	err = os.WriteFile(ndjson, []byte(
+		`{"timestamp":"2024-05-01T10:00:00Z","method":"post","path":"/employee","body":"{}"}`+"\n"+
+			`{"timestamp":"2024-05-01T10:00:01Z","path":"/employee-by-email/a@x.com","status":200,"duration_ms":1}`+"\n",
+	), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, _, err = readReplayLog(ndjson, ReplayFormatAuto)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Method != http.MethodPost || string(entries[0].Body) != "{}" ||
+		entries[1].Method != http.MethodGet || entries[1].Duration != time.Millisecond {
+		t.Errorf("unexpected entries: %+v", entries)
+	}
+
+	if _, _, err := readReplayLog(access, ReplayFormatNDJSON); err == nil {
+		t.Errorf("expected an error for the access log read as NDJSON")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost:
+			w.WriteHeader(http.StatusCreated)
+		case strings.HasPrefix(r.URL.Path, "/employee-by-email/c@"):
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	c, err := newClient(Config{WorkersCount: 2, HTTP: HTTPConfig{TargetURL: srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	t0 := time.Now()
+	entries := []logEntry{
+		{Time: t0, Method: http.MethodGet, Path: "/employee-by-email/a@x.com", Status: http.StatusOK},
+		{Time: t0.Add(50 * time.Millisecond), Method: http.MethodPost, Path: "/employee", Body: []byte("{}"), Status: http.StatusCreated},
+		{Time: t0.Add(100 * time.Millisecond), Method: http.MethodGet, Path: "/employee-by-email/b@x.com", Status: http.StatusNotFound},
+		{Time: t0.Add(100 * time.Millisecond), Method: http.MethodGet, Path: "/employee-by-email/c@x.com", Status: http.StatusOK},
+	}
+	start := time.Now()
+	outcomes := replay(context.Background(), ReplayConfig{Speed: 1, MaxInFlight: 2}, c, nil, entries)
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("the relative timing is not preserved, the replay took %v", elapsed)
+	}
+
+	d := newReplayDeviation()
+	for i, o := range outcomes {
+		d.add(entries[i], o)
+	}
+	if d.Compared != 4 || d.mismatches() != 2 || d.Mismatches["200->404"] != 1 || d.Mismatches["200->503"] != 1 {
+		t.Errorf("unexpected deviation: %+v", d)
+	}
+	var statusErr *unexpectedStatusError
+	if !errors.As(outcomes[3].Err, &statusErr) || outcomes[1].Err != nil || outcomes[2].Err != nil {
+		t.Errorf("want only the 503 response to be an error, got %v, %v, %v",
+			outcomes[1].Err, outcomes[2].Err, outcomes[3].Err)
+	}
+}
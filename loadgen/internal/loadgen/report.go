@@ -0,0 +1,107 @@
+package loadgen
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+func printResult(cfg Config, res loadTestResult) {
+	printStats("total", res)
+	printPhases(res.Phases)
+	if res.Warmup != nil {
+		printStats("warmup (not included)", *res.Warmup)
+	}
+	for i, s := range res.Stages {
+		printStats(fmt.Sprintf("stage %d (%v)", i+1, cfg.Stages[i]), s)
+	}
+	if len(res.Operations) > 1 {
+		ops := make([]string, 0, len(res.Operations))
+		for op := range res.Operations {
+			ops = append(ops, op)
+		}
+		sort.Strings(ops)
+		for _, op := range ops {
+			printStats(op, *res.Operations[op])
+		}
+	}
+	printKeyStats(res.Keys)
+}
+
+func printPhases(s phaseStats) {
+	if s.ReusedConns+s.NewConns == 0 {
+		return
+	}
+	log.Printf(
+		"connections: reused: %.2f%% (%d reused, %d new)", s.ReuseRatio()*100, s.ReusedConns, s.NewConns,
+	)
+	for _, p := range s.phases() {
+		if p.Hist.Count() == 0 {
+			continue
+		}
+		l := p.Hist.Summary()
+		log.Printf(
+			"phase %s: count %d, mean %v, p50 %v, p90 %v, p99 %v, max %v",
+			p.Name, l.Count, l.Mean, l.P50, l.P90, l.P99, l.Max,
+		)
+	}
+}
+
+func printKeyStats(s *keyStats) {
+	if s == nil {
+		return
+	}
+	log.Printf(
+		"keys (%s): requests: %d, keys: %d, touched: %d (%.1f%%), hottest key: %.2f%%, top 1%%: %.2f%%, top 10%%: %.2f%%",
+		s.Distribution, s.Requests, s.Keys, s.Touched, float64(s.Touched)/float64(s.Keys)*100,
+		s.TopKeyShare*100, s.Top1PctShare*100, s.Top10PctShare*100,
+	)
+}
+
+func printThresholds(results []thresholdResult) {
+	for _, r := range results {
+		log.Printf("threshold %v", r)
+	}
+}
+
+func printStats(title string, res loadTestResult) {
+	log.Printf(
+		"%s: ops: %d, errors: %d (%.2f%%), duration: %v, ops per second: %.1f",
+		title, res.Ops, res.Errors, res.ErrorRate()*100, res.Duration.Round(time.Millisecond), res.OpsPerSecond(),
+	)
+	if res.Cancelled > 0 {
+		log.Printf("%s: cancelled at end of test: %d", title, res.Cancelled)
+	}
+	if res.Scheduled > 0 {
+		log.Printf(
+			"%s: scheduled: %d, dropped (no free worker): %d (%.2f%%)",
+			title, res.Scheduled, res.Dropped, float64(res.Dropped)/float64(res.Scheduled)*100,
+		)
+	}
+	if len(res.StatusCodes) > 0 {
+		codes := make([]int, 0, len(res.StatusCodes))
+		for c := range res.StatusCodes {
+			codes = append(codes, c)
+		}
+		sort.Ints(codes)
+		parts := make([]string, 0, len(codes))
+		for _, c := range codes {
+			parts = append(parts, fmt.Sprintf("%d: %d", c, res.StatusCodes[c]))
+		}
+		log.Printf("%s: status codes: %s", title, strings.Join(parts, ", "))
+	}
+	for _, category := range res.ErrorCategories.sorted() {
+		c := res.ErrorCategories[category]
+		log.Printf(
+			"%s: errors: %s: %d (first at %s, last at %s), e.g.: %s",
+			title, category, c.Count, c.First.Format(time.TimeOnly), c.Last.Format(time.TimeOnly), c.Sample,
+		)
+	}
+	l := res.Latency.Summary()
+	log.Printf(
+		"%s: latency: mean %v, stddev %v, p50 %v, p90 %v, p99 %v, p99.9 %v, max %v",
+		title, l.Mean, l.StdDev, l.P50, l.P90, l.P99, l.P999, l.Max,
+	)
+}
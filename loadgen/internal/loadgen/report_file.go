@@ -0,0 +1,209 @@
+package loadgen
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"loadgen/internal/report"
+	"loadgen/internal/stats"
+)
+
+type ReportConfig struct {
+	// JSONPath and CSVPath are the files the report is written to, the empty ones are skipped.
+	JSONPath string
+	CSVPath  string
+}
+
+func writeReports(cfg Config, res loadTestResult, thresholds []thresholdResult, started, finished time.Time) error {
+	if cfg.Report.JSONPath == "" && cfg.Report.CSVPath == "" {
+		return nil
+	}
+	r, err := buildReport(cfg, res, thresholds, started, finished)
+	if err != nil {
+		return err
+	}
+	if cfg.Report.JSONPath != "" {
+		if err := report.WriteJSON(cfg.Report.JSONPath, r); err != nil {
+			return err
+		}
+	}
+	if cfg.Report.CSVPath != "" {
+		if err := report.WriteCSV(cfg.Report.CSVPath, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func buildReport(
+	cfg Config,
+	res loadTestResult,
+	thresholds []thresholdResult,
+	started, finished time.Time,
+) (*report.Report, error) {
+	c, err := json.Marshal(redactConfig(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal the config: %w", err)
+	}
+	hostname, _ := os.Hostname()
+	r := &report.Report{
+		Meta: report.Meta{
+			RunID:       newRunID(),
+			StartedAt:   started,
+			FinishedAt:  finished,
+			Hostname:    hostname,
+			GoVersion:   runtime.Version(),
+			OS:          runtime.GOOS,
+			Arch:        runtime.GOARCH,
+			NumCPU:      runtime.NumCPU(),
+			Args:        redactArgs(os.Args),
+			Seed:        cfg.Seed,
+			Interrupted: res.Interrupted,
+			Aborted:     res.Aborted,
+			Agents:      res.Agents,
+		},
+		Config: c,
+		Total:  reportStats("total", res),
+	}
+	if len(res.Operations) > 0 {
+		r.Operations = make(map[string]report.Stats, len(res.Operations))
+		for op, o := range res.Operations {
+			r.Operations[op] = reportStats(op, *o)
+		}
+	}
+	for i, s := range res.Stages {
+		r.Stages = append(r.Stages, reportStats(fmt.Sprintf("stage %d (%v)", i+1, cfg.Stages[i]), s))
+	}
+	if res.Warmup != nil {
+		w := reportStats("warmup", *res.Warmup)
+		r.Warmup = &w
+	}
+	if p := res.Phases; p.ReusedConns+p.NewConns > 0 {
+		r.Phases = &report.Phases{
+			ReuseRatio:  p.ReuseRatio(),
+			ReusedConns: p.ReusedConns,
+			NewConns:    p.NewConns,
+			Latency:     make(map[string]report.Latency),
+		}
+		for _, ph := range p.phases() {
+			if ph.Hist.Count() > 0 {
+				r.Phases.Latency[ph.Name] = reportLatency(ph.Hist.Summary())
+			}
+		}
+	}
+	if k := res.Keys; k != nil {
+		r.Keys = &report.Keys{
+			Distribution:  k.Distribution,
+			Keys:          k.Keys,
+			Requests:      k.Requests,
+			Touched:       k.Touched,
+			TopKeyShare:   k.TopKeyShare,
+			Top1PctShare:  k.Top1PctShare,
+			Top10PctShare: k.Top10PctShare,
+		}
+	}
+	for _, t := range thresholds {
+		actual := t.Threshold.formatValue(t.Actual)
+		if t.Missing {
+			actual = ""
+		}
+		r.Thresholds = append(r.Thresholds, report.Threshold{
+			Threshold: t.Threshold.String(),
+			Actual:    actual,
+			Passed:    t.Passed,
+		})
+	}
+	return r, nil
+}
+
+// redactConfig strips the passwords of the DSNs, the reports are kept as baselines and shared.
+// The config itself keeps them, e.g. the agents of a distributed test need them.
+func redactConfig(cfg Config) Config {
+	cfg.Keys.KnownEmailsDSN = redactDSN(cfg.Keys.KnownEmailsDSN)
+	cfg.DriverDSN = redactDSN(cfg.DriverDSN)
+	return cfg
+}
+
+// redactArgs strips the passwords of the DSNs passed in the command line arguments.
+func redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	for i, a := range args {
+		if name, value, ok := strings.Cut(a, "="); ok && strings.HasPrefix(name, "-") {
+			redacted[i] = name + "=" + redactDSN(value)
+			continue
+		}
+		redacted[i] = redactDSN(a)
+	}
+	return redacted
+}
+
+var dsnPassword = regexp.MustCompile(`(password=)('[^']*'|[^\s&]*)`)
+
+// redactDSN replaces the password of both the URL and the keyword/value DSN with "xxxxx".
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" && u.User != nil {
+		dsn = u.Redacted()
+	}
+	return dsnPassword.ReplaceAllString(dsn, "${1}xxxxx")
+}
+
+func reportStats(name string, res loadTestResult) report.Stats {
+	s := report.Stats{
+		Name:         name,
+		DurationSec:  res.Duration.Seconds(),
+		Ops:          res.Ops,
+		Errors:       res.Errors,
+		Cancelled:    res.Cancelled,
+		ErrorRate:    res.ErrorRate(),
+		OpsPerSecond: res.OpsPerSecond(),
+		Scheduled:    res.Scheduled,
+		Dropped:      res.Dropped,
+		Latency:      reportLatency(res.Latency.Summary()),
+	}
+	for _, category := range res.ErrorCategories.sorted() {
+		c := res.ErrorCategories[category]
+		s.ErrorCategories = append(s.ErrorCategories, report.ErrorCategory{
+			Category: category,
+			Count:    c.Count,
+			First:    c.First,
+			Last:     c.Last,
+			Sample:   c.Sample,
+		})
+	}
+	if len(res.StatusCodes) > 0 {
+		s.StatusCodes = make(map[string]int64, len(res.StatusCodes))
+		for code, n := range res.StatusCodes {
+			s.StatusCodes[strconv.Itoa(code)] = n
+		}
+	}
+	return s
+}
+
+func reportLatency(l stats.Summary) report.Latency {
+	return report.Latency{
+		Count:    l.Count,
+		MinMs:    report.Ms(l.Min),
+		MeanMs:   report.Ms(l.Mean),
+		StdDevMs: report.Ms(l.StdDev),
+		P50Ms:    report.Ms(l.P50),
+		P90Ms:    report.Ms(l.P90),
+		P99Ms:    report.Ms(l.P99),
+		P999Ms:   report.Ms(l.P999),
+		MaxMs:    report.Ms(l.Max),
+	}
+}
+
+func newRunID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,337 @@
+package loadgen
+
+import (
+	"time"
+
+	"loadgen/internal/stats"
+)
+
+type loadTestResult struct {
+	Duration time.Duration
+	Ops      int64
+	// Errors is the number of failed operations, they are not included into Ops.
+	Errors int64
+	// Cancelled is the number of requests which were still in flight when the test ended.
+	// They are neither successful nor failed.
+	Cancelled int64
+	// Interrupted is set if the test was stopped before its planned end, e.g. by a signal.
+	Interrupted bool
+	// Aborted is set if the test was stopped because a threshold had been irrecoverably breached.
+	Aborted bool
+	// StatusCodes counts the responses by the status code, both successful and failed.
+	StatusCodes map[int]int64
+	// ErrorCategories aggregates the errors by their kind.
+	ErrorCategories errorStats
+	// Latency holds the latencies of the successful operations.
+	Latency *stats.Histogram
+	// Scheduled and Dropped are only filled in the constant arrival rate mode.
+	// Dropped requests are the ones which were due while no worker was free.
+	Scheduled int64
+	Dropped   int64
+	// Stages breaks the results down by the stages of the load profile.
+	Stages []loadTestResult
+	// Operations breaks the results down by the operation.
+	Operations map[string]*loadTestResult
+	// Phases breaks the latency down by the connection phases, it is only filled in the totals.
+	Phases phaseStats
+	// Warmup holds the results of the requests started during the warm-up, they are not included
+	// into the other figures. It is nil if there was no warm-up.
+	Warmup *loadTestResult
+	// Keys is the realised distribution of the requested emails, it is only set for a fixed key space.
+	Keys *keyStats
+	// Agents is the number of the agents the results are merged from, it is zero for a local test.
+	Agents int
+
+	// keyRequests counts the requests by the index of the looked up key, Keys is derived from it.
+	keyRequests map[int]int64
+}
+
+func newLoadTestResult(stagesCount int) loadTestResult {
+	r := loadTestResult{
+		Latency: stats.NewHistogram(),
+		Phases:  newPhaseStats(),
+	}
+	if stagesCount > 0 {
+		r.Stages = make([]loadTestResult, stagesCount)
+		for i := range r.Stages {
+			r.Stages[i] = newLoadTestResult(0)
+		}
+	}
+	return r
+}
+
+func (r loadTestResult) OpsPerSecond() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Ops) / r.Duration.Seconds()
+}
+
+func (r loadTestResult) ErrorRate() float64 {
+	total := r.Ops + r.Errors
+	if total == 0 {
+		return 0
+	}
+	return float64(r.Errors) / float64(total)
+}
+
+func (r *loadTestResult) addWorkerResult(w workerResult) {
+	for idx, n := range w.KeyRequests {
+		if r.keyRequests == nil {
+			r.keyRequests = make(map[int]int64)
+		}
+		r.keyRequests[idx] += n
+	}
+	r.Ops += w.Ops
+	r.Errors += w.Errors
+	r.Cancelled += w.Cancelled
+	for code, n := range w.StatusCodes {
+		if r.StatusCodes == nil {
+			r.StatusCodes = make(map[int]int64)
+		}
+		r.StatusCodes[code] += n
+	}
+	if len(w.ErrorCategories) > 0 {
+		if r.ErrorCategories == nil {
+			r.ErrorCategories = make(errorStats)
+		}
+		r.ErrorCategories.merge(w.ErrorCategories)
+	}
+	r.Latency.Merge(w.Latency)
+	r.Phases.merge(w.Phases)
+	for i := range w.Stages {
+		r.Stages[i].addWorkerResult(w.Stages[i])
+	}
+	if w.Warmup != nil {
+		if r.Warmup == nil {
+			res := newLoadTestResult(0)
+			r.Warmup = &res
+		}
+		r.Warmup.addWorkerResult(*w.Warmup)
+	}
+	for op, wo := range w.Operations {
+		if r.Operations == nil {
+			r.Operations = make(map[string]*loadTestResult)
+		}
+		o, ok := r.Operations[op]
+		if !ok {
+			res := newLoadTestResult(0)
+			o = &res
+			r.Operations[op] = o
+		}
+		o.addWorkerResult(*wo)
+	}
+}
+
+func (r *loadTestResult) addSchedulerResult(s schedulerResult) {
+	r.Scheduled += s.Scheduled
+	r.Dropped += s.Dropped
+	for i := range s.Stages {
+		r.Stages[i].addSchedulerResult(s.Stages[i])
+	}
+}
+
+// merge adds the results of a concurrent test, e.g. run by another agent, to r.
+// The duration is the longest one, the key statistics cannot be merged and are dropped.
+func (r *loadTestResult) merge(o loadTestResult) {
+	r.Duration = max(r.Duration, o.Duration)
+	r.Ops += o.Ops
+	r.Errors += o.Errors
+	r.Cancelled += o.Cancelled
+	r.Interrupted = r.Interrupted || o.Interrupted
+	r.Aborted = r.Aborted || o.Aborted
+	for code, n := range o.StatusCodes {
+		if r.StatusCodes == nil {
+			r.StatusCodes = make(map[int]int64)
+		}
+		r.StatusCodes[code] += n
+	}
+	if len(o.ErrorCategories) > 0 {
+		if r.ErrorCategories == nil {
+			r.ErrorCategories = make(errorStats)
+		}
+		r.ErrorCategories.merge(o.ErrorCategories)
+	}
+	r.Latency.Merge(o.Latency)
+	r.Phases.merge(o.Phases)
+	r.Scheduled += o.Scheduled
+	r.Dropped += o.Dropped
+	for i := range o.Stages {
+		if i < len(r.Stages) {
+			r.Stages[i].merge(o.Stages[i])
+		}
+	}
+	if o.Warmup != nil {
+		if r.Warmup == nil {
+			res := newLoadTestResult(0)
+			r.Warmup = &res
+		}
+		r.Warmup.merge(*o.Warmup)
+	}
+	for op, oo := range o.Operations {
+		if r.Operations == nil {
+			r.Operations = make(map[string]*loadTestResult)
+		}
+		ro, ok := r.Operations[op]
+		if !ok {
+			res := newLoadTestResult(0)
+			ro = &res
+			r.Operations[op] = ro
+		}
+		ro.merge(*oo)
+	}
+	r.Keys = nil
+}
+
+// setDuration sets the actual test duration and derives the durations of the stages from it.
+// The warm-up is excluded from the duration.
+func (r *loadTestResult) setDuration(d time.Duration, stages []Stage, warmup time.Duration) {
+	if warmup > 0 {
+		if r.Warmup != nil {
+			r.Warmup.setDuration(min(d, warmup), nil, 0)
+		}
+		d = max(d-warmup, 0)
+	}
+	r.Duration = d
+	for _, o := range r.Operations {
+		o.Duration = d
+	}
+	var stageStart time.Duration
+	for i, s := range stages {
+		stageDur := s.Duration
+		if i == len(stages)-1 || stageStart+stageDur > d {
+			stageDur = d - stageStart
+		}
+		if stageDur < 0 {
+			stageDur = 0
+		}
+		r.Stages[i].Duration = stageDur
+		stageStart += s.Duration
+	}
+}
+
+type workerResult struct {
+	Ops             int64
+	Errors          int64
+	Cancelled       int64
+	StatusCodes     map[int]int64
+	ErrorCategories errorStats
+	Latency         *stats.Histogram
+	Phases          phaseStats
+	Stages          []workerResult
+	Operations      map[string]*workerResult
+	Warmup          *workerResult
+	// KeyRequests counts the requests by the index of the looked up key, it is not broken down by the stage.
+	KeyRequests map[int]int64
+}
+
+func newWorkerResult(stagesCount int) workerResult {
+	r := workerResult{
+		Latency: stats.NewHistogram(),
+		Phases:  newPhaseStats(),
+	}
+	if stagesCount > 0 {
+		r.Stages = make([]workerResult, stagesCount)
+		for i := range r.Stages {
+			r.Stages[i] = newWorkerResult(0)
+		}
+	}
+	return r
+}
+
+// record accounts for the outcome of a single operation.
+// The status code is zero if no response has been received.
+func (r *workerResult) record(op string, stage int, code int, latency time.Duration, err error) {
+	r.add(code, latency, err)
+	if stage >= 0 && stage < len(r.Stages) {
+		r.Stages[stage].add(code, latency, err)
+	}
+	if op != "" {
+		r.operation(op).add(code, latency, err)
+	}
+}
+
+// recordKey counts a request for the key of the email source, idx is -1 for the other emails.
+func (r *workerResult) recordKey(idx int) {
+	if idx < 0 {
+		return
+	}
+	if r.KeyRequests == nil {
+		r.KeyRequests = make(map[int]int64)
+	}
+	r.KeyRequests[idx]++
+}
+
+// recordCancelled accounts for an operation interrupted by the end of the test.
+func (r *workerResult) recordCancelled(op string, stage int) {
+	r.Cancelled++
+	if stage >= 0 && stage < len(r.Stages) {
+		r.Stages[stage].Cancelled++
+	}
+	if op != "" {
+		r.operation(op).Cancelled++
+	}
+}
+
+// warmup returns the result the requests started during the warm-up are accounted in.
+func (r *workerResult) warmup() *workerResult {
+	if r.Warmup == nil {
+		res := newWorkerResult(0)
+		r.Warmup = &res
+	}
+	return r.Warmup
+}
+
+func (r *workerResult) operation(op string) *workerResult {
+	if r.Operations == nil {
+		r.Operations = make(map[string]*workerResult)
+	}
+	o, ok := r.Operations[op]
+	if !ok {
+		res := newWorkerResult(0)
+		o = &res
+		r.Operations[op] = o
+	}
+	return o
+}
+
+func (r *workerResult) add(code int, latency time.Duration, err error) {
+	if code != 0 {
+		if r.StatusCodes == nil {
+			r.StatusCodes = make(map[int]int64)
+		}
+		r.StatusCodes[code]++
+	}
+	if err != nil {
+		r.Errors++
+		if r.ErrorCategories == nil {
+			r.ErrorCategories = make(errorStats)
+		}
+		r.ErrorCategories.add(classifyError(err), time.Now(), err)
+		return
+	}
+	r.Ops++
+	r.Latency.Record(latency)
+}
+
+type schedulerResult struct {
+	Scheduled int64
+	Dropped   int64
+	Stages    []schedulerResult
+}
+
+func newSchedulerResult(stagesCount int) schedulerResult {
+	return schedulerResult{
+		Stages: make([]schedulerResult, stagesCount),
+	}
+}
+
+func (r *schedulerResult) record(stage int, dropped bool) {
+	r.Scheduled++
+	if dropped {
+		r.Dropped++
+	}
+	if stage >= 0 && stage < len(r.Stages) {
+		r.Stages[stage].record(-1, dropped)
+	}
+}
@@ -0,0 +1,84 @@
+package loadgen
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSetDurationExcludesWarmup(t *testing.T) {
+	cases := []struct {
+		elapsed, warmup     time.Duration
+		duration, warmupDur time.Duration
+	}{
+		{500 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 200 * time.Millisecond},
+		// interrupted during the warm-up
+		{100 * time.Millisecond, 200 * time.Millisecond, 0, 100 * time.Millisecond},
+		{500 * time.Millisecond, 0, 500 * time.Millisecond, 0},
+	}
+	for _, c := range cases {
+		r := newLoadTestResult(0)
+		r.Warmup = &loadTestResult{}
+		r.setDuration(c.elapsed, nil, c.warmup)
+		if r.Duration != c.duration || r.Warmup.Duration != c.warmupDur {
+			t.Errorf("%v with %v warm-up: duration %v, warm-up %v; want %v and %v",
+				c.elapsed, c.warmup, r.Duration, r.Warmup.Duration, c.duration, c.warmupDur)
+		}
+	}
+}
+
+func TestWarmupSplit(t *testing.T) {
+	srv := newScriptedServer(scriptedResponse{http.StatusNotFound, time.Millisecond})
+	defer srv.Close()
+
+	const (
+		warmup   = 200 * time.Millisecond
+		duration = 200 * time.Millisecond
+		rate     = 200
+	)
+	for _, mode := range []string{"workers", "rate"} {
+		t.Run(mode, func(t *testing.T) {
+			cfg := newTestConfig(srv.URL)
+			cfg.Warmup = warmup
+			cfg.Duration = duration
+			cfg.Keys = KeysConfig{Distribution: KeyDistribution{Kind: DistUniform}, KeySpace: 10}
+			run := runGenerator
+			if mode == "rate" {
+				cfg.Rate = rate
+				run = runRateGenerator
+			}
+			env, err := newTestEnv(context.Background(), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := run(context.Background(), cfg, &fakeNames{}, env)
+			env.close()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if res.Warmup == nil || res.Warmup.Ops == 0 || res.Ops == 0 {
+				t.Fatalf("want the requests both in the warm-up and in the measurement, got %+v", res)
+			}
+			if res.Warmup.Duration != warmup {
+				t.Errorf("warm-up duration %v, want %v", res.Warmup.Duration, warmup)
+			}
+			if res.Duration < duration || res.Duration > duration+stopBound {
+				t.Errorf("duration %v, want only the measured %v", res.Duration, duration)
+			}
+			if res.Latency.Count() != res.Ops {
+				t.Errorf("latency has %d samples, want the measured ops %d", res.Latency.Count(), res.Ops)
+			}
+			if ks := env.emails.stats(res.keyRequests); ks.Requests != res.Ops+res.Errors {
+				t.Errorf("%d key requests counted, want the measured requests %d", ks.Requests, res.Ops+res.Errors)
+			}
+			if mode == "rate" {
+				// the requests due during the warm-up are not scheduled in the measured window
+				if limit := int64(rate*duration.Seconds()) + 5; res.Scheduled > limit {
+					t.Errorf("%d requests scheduled, want at most %d", res.Scheduled, limit)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package loadgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// scenarioFile is the JSON representation of a load test scenario.
+// All the fields are optional except the requests, the omitted ones keep the values
+// set by the command line flags.
+type scenarioFile struct {
+	Target       string            `json:"target"`
+	Duration     *jsonDuration     `json:"duration"`
+	Warmup       *jsonDuration     `json:"warmup"`
+	Workers      *int              `json:"workers"`
+	Rate         *int              `json:"rate"`
+	Stages       []scenarioStage   `json:"stages"`
+	StagesTarget string            `json:"stages_target"`
+	DataFile     string            `json:"data_file"`
+	Requests     []scenarioRequest `json:"requests"`
+	ThinkTime    string            `json:"think_time"`
+	Pacing       *jsonDuration     `json:"pacing"`
+	Thresholds   []string          `json:"thresholds"`
+	AbortOnFail  *bool             `json:"abort_on_fail"`
+}
+
+type scenarioStage struct {
+	Duration jsonDuration `json:"duration"`
+	// From defaults to the target the previous stage has ended with.
+	From *int `json:"from"`
+	To   int  `json:"to"`
+}
+
+type scenarioRequest struct {
+	Name      string            `json:"name"`
+	Method    string            `json:"method"`
+	Path      string            `json:"path"`
+	Body      string            `json:"body"`
+	Headers   map[string]string `json:"headers"`
+	Weight    *int              `json:"weight"`
+	Expect    []int             `json:"expect"`
+	ThinkTime jsonDuration      `json:"think_time"`
+	Verify    string            `json:"verify"`
+}
+
+// jsonDuration is a time.Duration encoded as a string, e.g. "1m30s".
+type jsonDuration time.Duration
+
+func (d *jsonDuration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration should be a string like \"1m30s\", got %s", b)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = jsonDuration(v)
+	return nil
+}
+
+// ApplyScenario loads the scenario file and overrides the configuration with it.
+func ApplyScenario(path string, cfg *Config) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read the scenario file: %w", err)
+	}
+	sc, err := decodeScenario(b)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := sc.apply(cfg, filepath.Dir(path)); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func decodeScenario(b []byte) (*scenarioFile, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	sc := &scenarioFile{}
+	if err := d.Decode(sc); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			return nil, fmt.Errorf("%s: %w", position(b, syntaxErr.Offset), err)
+		case errors.As(err, &typeErr):
+			return nil, fmt.Errorf(
+				"%s: field %s should be of type %s, got %s",
+				position(b, typeErr.Offset), typeErr.Field, typeErr.Type, typeErr.Value,
+			)
+		}
+		return nil, err
+	}
+	if d.More() {
+		return nil, errors.New("unexpected data after the scenario object")
+	}
+	return sc, nil
+}
+
+// position converts the byte offset to the "line:column" form.
+func position(b []byte, offset int64) string {
+	if offset > int64(len(b)) {
+		offset = int64(len(b))
+	}
+	before := b[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := len(before) - bytes.LastIndexByte(before, '\n')
+	return fmt.Sprintf("line %d, column %d", line, col)
+}
+
+func (sc *scenarioFile) apply(cfg *Config, baseDir string) error {
+	if len(sc.Requests) == 0 {
+		return errors.New("requests: at least one request should be defined")
+	}
+
+	c := *cfg
+	if sc.Target != "" {
+		c.HTTP.TargetURL = sc.Target
+	}
+	if sc.Duration != nil {
+		if *sc.Duration <= 0 {
+			return fmt.Errorf("duration: should be positive, got %v", time.Duration(*sc.Duration))
+		}
+		c.Duration = time.Duration(*sc.Duration)
+	}
+	if sc.Warmup != nil {
+		if *sc.Warmup < 0 {
+			return fmt.Errorf("warmup: should not be negative, got %v", time.Duration(*sc.Warmup))
+		}
+		c.Warmup = time.Duration(*sc.Warmup)
+	}
+	if sc.ThinkTime != "" {
+		t, err := ParseThinkTime(sc.ThinkTime)
+		if err != nil {
+			return fmt.Errorf("think_time: %w", err)
+		}
+		c.ThinkTime = t
+	}
+	if sc.Pacing != nil {
+		if *sc.Pacing < 0 {
+			return fmt.Errorf("pacing: should not be negative, got %v", time.Duration(*sc.Pacing))
+		}
+		c.Pacing = time.Duration(*sc.Pacing)
+	}
+	if sc.Workers != nil {
+		if *sc.Workers <= 0 {
+			return fmt.Errorf("workers: should be greater than 0, got %d", *sc.Workers)
+		}
+		c.WorkersCount = *sc.Workers
+	}
+	if sc.Rate != nil {
+		if *sc.Rate < 0 {
+			return fmt.Errorf("rate: should not be negative, got %d", *sc.Rate)
+		}
+		c.Rate = *sc.Rate
+	}
+
+	if len(sc.Stages) > 0 {
+		c.Stages = make([]Stage, 0, len(sc.Stages))
+		prev := 0
+		for i, s := range sc.Stages {
+			st := Stage{
+				Duration: time.Duration(s.Duration),
+				From:     prev,
+				To:       s.To,
+			}
+			if s.From != nil {
+				st.From = *s.From
+			}
+			if err := st.validate(); err != nil {
+				return fmt.Errorf("stages[%d]: %w", i, err)
+			}
+			c.Stages = append(c.Stages, st)
+			prev = st.To
+		}
+	}
+	if sc.StagesTarget != "" {
+		if sc.StagesTarget != StageTargetWorkers && sc.StagesTarget != StageTargetRate {
+			return fmt.Errorf(
+				"stages_target: should be %s or %s, got %q", StageTargetWorkers, StageTargetRate, sc.StagesTarget,
+			)
+		}
+		c.StagesTarget = sc.StagesTarget
+	}
+
+	var data *dataSet
+	if sc.DataFile != "" {
+		c.DataFile = sc.DataFile
+		if !filepath.IsAbs(c.DataFile) {
+			c.DataFile = filepath.Join(baseDir, c.DataFile)
+		}
+		var err error
+		if data, err = loadDataSet(c.DataFile); err != nil {
+			return fmt.Errorf("data_file: %w", err)
+		}
+	}
+
+	c.Requests = make([]RequestSpec, 0, len(sc.Requests))
+	for i, r := range sc.Requests {
+		spec := RequestSpec{
+			Name:      r.Name,
+			Method:    strings.ToUpper(r.Method),
+			Path:      r.Path,
+			Body:      r.Body,
+			Headers:   r.Headers,
+			Weight:    1,
+			Expect:    r.Expect,
+			ThinkTime: time.Duration(r.ThinkTime),
+			Verify:    r.Verify,
+		}
+		if spec.Method == "" {
+			spec.Method = "GET"
+		}
+		if r.Weight != nil {
+			spec.Weight = *r.Weight
+		}
+		if spec.Name == "" {
+			spec.Name = spec.Method + " " + spec.Path
+		}
+		if _, err := newTemplateOp(spec, data); err != nil {
+			return fmt.Errorf("requests[%d]: %w", i, err)
+		}
+		c.Requests = append(c.Requests, spec)
+	}
+	if _, err := newMix(c.Requests, data); err != nil {
+		return fmt.Errorf("requests: %w", err)
+	}
+
+	if len(sc.Thresholds) > 0 {
+		c.Thresholds = make([]Threshold, 0, len(sc.Thresholds))
+		for i, s := range sc.Thresholds {
+			t, err := ParseThreshold(s)
+			if err != nil {
+				return fmt.Errorf("thresholds[%d]: %w", i, err)
+			}
+			c.Thresholds = append(c.Thresholds, t)
+		}
+	}
+	if sc.AbortOnFail != nil {
+		c.AbortOnFail = *sc.AbortOnFail
+	}
+
+	*cfg = c
+	return nil
+}
@@ -0,0 +1,96 @@
+package loadgen
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyScenario(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "scenario.json")
+	if err := os.WriteFile(path, []byte(`{
+		"duration": "2m",
+		"stages": [{"duration": "30s", "from": 1, "to": 50}, {"duration": "1m", "to": 50}],
+		"requests": [{"name": "lookup", "path": "/employee-by-email/{{email}}", "expect": [200, 404]}],
+		"thresholds": ["lookup:p99<50ms"]
+	}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Config{Duration: time.Second, WorkersCount: 10}
+	if err := ApplyScenario(path, &cfg); err != nil {
+		t.Fatalf("ApplyScenario() error = %v", err)
+	}
+	if cfg.Duration != 2*time.Minute || cfg.WorkersCount != 10 {
+		t.Errorf("unexpected duration/workers: %v/%d", cfg.Duration, cfg.WorkersCount)
+	}
+	wantStages := []Stage{{Duration: 30 * time.Second, From: 1, To: 50}, {Duration: time.Minute, From: 50, To: 50}}
+	if len(cfg.Stages) != 2 || cfg.Stages[0] != wantStages[0] || cfg.Stages[1] != wantStages[1] {
+		t.Errorf("Stages = %v, want %v", cfg.Stages, wantStages)
+	}
+	if len(cfg.Requests) != 1 || cfg.Requests[0].Method != "GET" || cfg.Requests[0].Weight != 1 {
+		t.Errorf("unexpected requests: %+v", cfg.Requests)
+	}
+	if len(cfg.Thresholds) != 1 || cfg.Thresholds[0].String() != "lookup:p99<50ms" {
+		t.Errorf("unexpected thresholds: %v", cfg.Thresholds)
+	}
+}
+
+func TestApplyScenarioErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "syntax error",
+			content: "{\n\"requests\": [,]}",
+			wantErr: "line 2, column 15",
+		},
+		{
+			name:    "wrong type",
+			content: "{\n\"workers\": \"10\"}",
+			wantErr: "field workers should be of type int",
+		},
+		{
+			name:    "unknown field",
+			content: `{"worker": 10}`,
+			wantErr: `unknown field "worker"`,
+		},
+		{
+			name:    "no requests",
+			content: `{"duration": "1m"}`,
+			wantErr: "at least one request",
+		},
+		{
+			name:    "unknown placeholder",
+			content: `{"requests": [{"name": "a", "path": "/x"}, {"name": "b", "path": "/{{mail}}"}]}`,
+			wantErr: "requests[1]: path: unknown placeholder {{mail}}",
+		},
+		{
+			name:    "bad duration",
+			content: `{"duration": "1 minute", "requests": [{"name": "a", "path": "/x"}]}`,
+			wantErr: `time: unknown unit`,
+		},
+		{
+			name:    "bad threshold",
+			content: `{"requests": [{"name": "a", "path": "/x"}], "thresholds": ["p42<1s"]}`,
+			wantErr: `thresholds[0]: threshold "p42<1s": unknown metric`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "scenario.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			err := ApplyScenario(path, &Config{})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ApplyScenario() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package loadgen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	StageTargetWorkers = "workers"
+	StageTargetRate    = "rate"
+)
+
+// Stage is a part of the load profile during which the target (the number of workers
+// or the arrival rate) changes linearly from From to To.
+type Stage struct {
+	Duration time.Duration
+	From     int
+	To       int
+}
+
+func (s Stage) String() string {
+	if s.From == s.To {
+		return fmt.Sprintf("%v at %d", s.Duration, s.To)
+	}
+	return fmt.Sprintf("%v from %d to %d", s.Duration, s.From, s.To)
+}
+
+// ParseStages parses the comma-separated list of stages in the form "duration:[from-]to",
+// e.g. "30s:1-50,2m:50,10s:200-200,30s:0". If from is omitted, the stage starts
+// at the target the previous stage has ended with (0 for the first stage).
+func ParseStages(s string) ([]Stage, error) {
+	var stages []Stage
+	prev := 0
+	for i, part := range strings.Split(s, ",") {
+		st, err := parseStage(strings.TrimSpace(part), prev)
+		if err != nil {
+			return nil, fmt.Errorf("stage #%d %q: %w", i+1, part, err)
+		}
+		stages = append(stages, st)
+		prev = st.To
+	}
+	return stages, nil
+}
+
+func parseStage(s string, prev int) (Stage, error) {
+	dur, target, ok := strings.Cut(s, ":")
+	if !ok {
+		return Stage{}, fmt.Errorf("expected the duration:[from-]to format")
+	}
+	st := Stage{From: prev}
+	var err error
+	if st.Duration, err = time.ParseDuration(dur); err != nil {
+		return Stage{}, fmt.Errorf("failed to parse the duration: %w", err)
+	}
+	if from, to, ok := strings.Cut(target, "-"); ok {
+		if st.From, err = strconv.Atoi(from); err != nil {
+			return Stage{}, fmt.Errorf("failed to parse the initial target: %w", err)
+		}
+		target = to
+	}
+	if st.To, err = strconv.Atoi(target); err != nil {
+		return Stage{}, fmt.Errorf("failed to parse the target: %w", err)
+	}
+	if err := st.validate(); err != nil {
+		return Stage{}, err
+	}
+	return st, nil
+}
+
+func (s Stage) validate() error {
+	if s.Duration < 0 {
+		return fmt.Errorf("duration should not be negative, got %v", s.Duration)
+	}
+	if s.From < 0 || s.To < 0 {
+		return fmt.Errorf("targets should not be negative, got %d-%d", s.From, s.To)
+	}
+	return nil
+}
+
+func stagesDuration(stages []Stage) time.Duration {
+	var d time.Duration
+	for _, s := range stages {
+		d += s.Duration
+	}
+	return d
+}
+
+// profile maps the time elapsed since the start of the test to the stages.
+type profile struct {
+	stages []Stage
+	start  time.Time
+}
+
+func newProfile(stages []Stage, start time.Time) *profile {
+	return &profile{
+		stages: stages,
+		start:  start,
+	}
+}
+
+func (p *profile) stagesCount() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.stages)
+}
+
+// stageAt returns the index of the stage active at t, or -1 if there is no profile.
+func (p *profile) stageAt(t time.Time) int {
+	if p == nil || len(p.stages) == 0 {
+		return -1
+	}
+	idx, _ := p.locate(t)
+	return idx
+}
+
+// targetAt returns the target interpolated at t.
+func (p *profile) targetAt(t time.Time) float64 {
+	idx, offset := p.locate(t)
+	s := p.stages[idx]
+	if s.Duration == 0 || offset >= s.Duration {
+		return float64(s.To)
+	}
+	progress := float64(offset) / float64(s.Duration)
+	return float64(s.From) + float64(s.To-s.From)*progress
+}
+
+func (p *profile) locate(t time.Time) (int, time.Duration) {
+	elapsed := t.Sub(p.start)
+	var stageStart time.Duration
+	for i, s := range p.stages {
+		if elapsed < stageStart+s.Duration {
+			return i, elapsed - stageStart
+		}
+		stageStart += s.Duration
+	}
+	last := len(p.stages) - 1
+	return last, elapsed - (stageStart - p.stages[last].Duration)
+}
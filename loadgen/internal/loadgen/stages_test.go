@@ -0,0 +1,85 @@
+package loadgen
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseStages(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []Stage
+	}{
+		{"30s:1-50,2m:50,10s:200-200,30s:0", []Stage{
+			{Duration: 30 * time.Second, From: 1, To: 50},
+			{Duration: 2 * time.Minute, From: 50, To: 50},
+			{Duration: 10 * time.Second, From: 200, To: 200},
+			{Duration: 30 * time.Second, From: 200, To: 0},
+		}},
+		{" 10s:5 , 0s:7", []Stage{
+			{Duration: 10 * time.Second, From: 0, To: 5},
+			{Duration: 0, From: 5, To: 7},
+		}},
+	}
+	for _, c := range cases {
+		got, err := ParseStages(c.in)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", c.in, err)
+			continue
+		}
+		if len(got) != len(c.want) {
+			t.Errorf("%q: got %v, want %v", c.in, got, c.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("%q: stage #%d is %+v, want %+v", c.in, i+1, got[i], c.want[i])
+			}
+		}
+	}
+	for _, in := range []string{"", "10s", "x:5", "10s:a", "10s:a-5", "10s:5-", "-1s:5", "10s:5,1s:-1-2"} {
+		if _, err := ParseStages(in); err == nil {
+			t.Errorf("%q: expected an error", in)
+		}
+	}
+}
+
+func TestProfile(t *testing.T) {
+	start := time.Now()
+	p := newProfile([]Stage{
+		{Duration: 100 * time.Millisecond, From: 0, To: 10},
+		{Duration: 100 * time.Millisecond, From: 10, To: 10},
+		// a zero-length stage is a jump, its target is where the next stage starts
+		{Duration: 0, From: 10, To: 20},
+		{Duration: 100 * time.Millisecond, From: 20, To: 0},
+	}, start)
+	cases := []struct {
+		at     time.Duration
+		stage  int
+		target float64
+	}{
+		{0, 0, 0},
+		{50 * time.Millisecond, 0, 5},
+		{100 * time.Millisecond, 1, 10},
+		{150 * time.Millisecond, 1, 10},
+		{200 * time.Millisecond, 3, 20},
+		{250 * time.Millisecond, 3, 10},
+		// the last stage holds its target after the end of the profile
+		{300 * time.Millisecond, 3, 0},
+		{time.Second, 3, 0},
+	}
+	for _, c := range cases {
+		at := start.Add(c.at)
+		if stage := p.stageAt(at); stage != c.stage {
+			t.Errorf("%v: stage %d, want %d", c.at, stage, c.stage)
+		}
+		if target := p.targetAt(at); target != c.target {
+			t.Errorf("%v: target %v, want %v", c.at, target, c.target)
+		}
+	}
+
+	var none *profile
+	if stage := none.stageAt(start); stage != -1 || none.stagesCount() != 0 {
+		t.Errorf("no profile: stage %d of %d, want -1 of 0", stage, none.stagesCount())
+	}
+}
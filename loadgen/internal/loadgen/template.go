@@ -0,0 +1,85 @@
+package loadgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// template is a string with {{placeholder}} substitutions, e.g. "/employee-by-email/{{email}}".
+type template struct {
+	segments []templateSegment
+}
+
+type templateSegment struct {
+	literal string
+	// variable is the placeholder name, the segment is a literal if it is empty.
+	variable string
+}
+
+// parseTemplate parses the template and checks that all the placeholders are known.
+func parseTemplate(s string, known func(string) bool) (*template, error) {
+	t := &template{}
+	for s != "" {
+		start := strings.Index(s, "{{")
+		if start < 0 {
+			t.segments = append(t.segments, templateSegment{literal: s})
+			break
+		}
+		if start > 0 {
+			t.segments = append(t.segments, templateSegment{literal: s[:start]})
+		}
+		end := strings.Index(s[start:], "}}")
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed placeholder at offset %d", start)
+		}
+		name := strings.TrimSpace(s[start+2 : start+end])
+		if name == "" {
+			return nil, fmt.Errorf("empty placeholder at offset %d", start)
+		}
+		if !known(name) {
+			return nil, fmt.Errorf("unknown placeholder {{%s}}", name)
+		}
+		t.segments = append(t.segments, templateSegment{variable: name})
+		s = s[start+end+2:]
+	}
+	return t, nil
+}
+
+type escapeFunc func(string) string
+
+func escapeNone(s string) string {
+	return s
+}
+
+// escapeJSON escapes the value to be placed inside a JSON string literal.
+func escapeJSON(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b[1 : len(b)-1])
+}
+
+var escapePath escapeFunc = url.PathEscape
+
+func (t *template) render(sb *strings.Builder, vars func(string) string, escape escapeFunc) {
+	for _, s := range t.segments {
+		if s.variable == "" {
+			sb.WriteString(s.literal)
+			continue
+		}
+		sb.WriteString(escape(vars(s.variable)))
+	}
+}
+
+func (t *template) hasVar(name string) bool {
+	for _, s := range t.segments {
+		if s.variable == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *template) isEmpty() bool {
+	return t == nil || len(t.segments) == 0
+}
@@ -0,0 +1,106 @@
+package loadgen
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+const (
+	ThinkTimeFixed       = "fixed"
+	ThinkTimeUniform     = "uniform"
+	ThinkTimeExponential = "exp"
+)
+
+// ThinkTime is the distribution of the pause a closed-model worker makes after every request.
+type ThinkTime struct {
+	Dist string
+	// Value is the pause of the fixed distribution, the lower bound of the uniform one
+	// and the mean of the exponential one.
+	Value time.Duration
+	// Max is the upper bound of the uniform distribution.
+	Max time.Duration
+}
+
+func (t ThinkTime) String() string {
+	switch t.Dist {
+	case ThinkTimeUniform:
+		return fmt.Sprintf("%s:%v-%v", t.Dist, t.Value, t.Max)
+	case "":
+		return "none"
+	}
+	return fmt.Sprintf("%s:%v", t.Dist, t.Value)
+}
+
+// ParseThinkTime parses the distribution in one of the forms: "fixed:100ms",
+// "uniform:50ms-150ms" or "exp:100ms" (exponential with the 100ms mean).
+func ParseThinkTime(s string) (ThinkTime, error) {
+	dist, value, ok := strings.Cut(s, ":")
+	if !ok {
+		return ThinkTime{}, fmt.Errorf("expected the distribution:value format")
+	}
+	t := ThinkTime{Dist: dist}
+	var err error
+	switch dist {
+	case ThinkTimeFixed, ThinkTimeExponential:
+		t.Value, err = time.ParseDuration(value)
+	case ThinkTimeUniform:
+		lo, hi, ok := strings.Cut(value, "-")
+		if !ok {
+			return ThinkTime{}, fmt.Errorf("expected the uniform:min-max format")
+		}
+		if t.Value, err = time.ParseDuration(lo); err == nil {
+			t.Max, err = time.ParseDuration(hi)
+		}
+	default:
+		return ThinkTime{}, fmt.Errorf("unknown think time distribution: %q", dist)
+	}
+	if err != nil {
+		return ThinkTime{}, fmt.Errorf("failed to parse the think time: %w", err)
+	}
+	return t, t.validate()
+}
+
+func (t ThinkTime) validate() error {
+	if t.Value < 0 || t.Max < 0 {
+		return fmt.Errorf("think time should not be negative")
+	}
+	if t.Dist == ThinkTimeUniform && t.Max < t.Value {
+		return fmt.Errorf("think time upper bound %v is less than the lower bound %v", t.Max, t.Value)
+	}
+	return nil
+}
+
+func (t ThinkTime) sample(rnd *rand.Rand) time.Duration {
+	switch t.Dist {
+	case ThinkTimeFixed:
+		return t.Value
+	case ThinkTimeUniform:
+		return t.Value + time.Duration(rnd.Int63n(int64(t.Max-t.Value)+1))
+	case ThinkTimeExponential:
+		return time.Duration(rnd.ExpFloat64() * float64(t.Value))
+	}
+	return 0
+}
+
+// pacer decides how long a closed-model worker (a virtual user) waits before the next request.
+type pacer struct {
+	think ThinkTime
+	// pacing is the interval between the starts of the requests of a virtual user.
+	pacing time.Duration
+}
+
+// pause returns the wait after the request started at start. The think time of the operation
+// takes precedence over the distribution, and the pacing extends the wait to the next interval.
+func (p pacer) pause(op operation, rnd *rand.Rand, start time.Time) time.Duration {
+	d := op.thinkTime()
+	if d == 0 {
+		d = p.think.sample(rnd)
+	}
+	if p.pacing > 0 {
+		// a request longer than the pacing interval is followed by the next one immediately
+		d = max(d, time.Until(start.Add(p.pacing)))
+	}
+	return d
+}
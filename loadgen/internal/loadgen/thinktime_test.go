@@ -0,0 +1,89 @@
+package loadgen
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestParseThinkTime(t *testing.T) {
+	cases := []struct {
+		in   string
+		want ThinkTime
+	}{
+		{"fixed:100ms", ThinkTime{Dist: ThinkTimeFixed, Value: 100 * time.Millisecond}},
+		{"uniform:50ms-150ms", ThinkTime{Dist: ThinkTimeUniform, Value: 50 * time.Millisecond, Max: 150 * time.Millisecond}},
+		{"exp:1s", ThinkTime{Dist: ThinkTimeExponential, Value: time.Second}},
+	}
+	for _, c := range cases {
+		got, err := ParseThinkTime(c.in)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", c.in, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%q: got %+v, want %+v", c.in, got, c.want)
+		}
+	}
+	for _, in := range []string{"100ms", "normal:1s", "fixed:x", "uniform:1s", "uniform:2s-1s", "exp:-1s"} {
+		if _, err := ParseThinkTime(in); err == nil {
+			t.Errorf("%q: expected an error", in)
+		}
+	}
+}
+
+func TestThinkTimeSample(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	const n = 100000
+	mean := func(tt ThinkTime, check func(time.Duration) bool) time.Duration {
+		var sum time.Duration
+		for i := 0; i < n; i++ {
+			d := tt.sample(rnd)
+			if !check(d) {
+				t.Fatalf("%v: sample %v is out of range", tt, d)
+			}
+			sum += d
+		}
+		return sum / n
+	}
+	near := func(got, want time.Duration) bool {
+		return got > want*97/100 && got < want*103/100
+	}
+
+	u := ThinkTime{Dist: ThinkTimeUniform, Value: 50 * time.Millisecond, Max: 150 * time.Millisecond}
+	if m := mean(u, func(d time.Duration) bool { return d >= u.Value && d <= u.Max }); !near(m, 100*time.Millisecond) {
+		t.Errorf("uniform mean is %v, want 100ms", m)
+	}
+	e := ThinkTime{Dist: ThinkTimeExponential, Value: 100 * time.Millisecond}
+	if m := mean(e, func(d time.Duration) bool { return d >= 0 }); !near(m, 100*time.Millisecond) {
+		t.Errorf("exponential mean is %v, want 100ms", m)
+	}
+}
+
+type fixedThinkOp struct {
+	templateOp
+	think time.Duration
+}
+
+func (op *fixedThinkOp) thinkTime() time.Duration {
+	return op.think
+}
+
+func TestPacerPause(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	p := pacer{think: ThinkTime{Dist: ThinkTimeFixed, Value: 10 * time.Millisecond}, pacing: time.Second}
+
+	// the pacing interval dominates a short request
+	if d := p.pause(&fixedThinkOp{}, rnd, time.Now()); d < 900*time.Millisecond || d > time.Second {
+		t.Errorf("pause after a short request is %v, want about 1s", d)
+	}
+	// a request longer than the interval is followed by the think time only
+	if d := p.pause(&fixedThinkOp{}, rnd, time.Now().Add(-2*time.Second)); d != 10*time.Millisecond {
+		t.Errorf("pause after a long request is %v, want 10ms", d)
+	}
+	// the think time of the operation takes precedence over the distribution
+	p.pacing = 0
+	if d := p.pause(&fixedThinkOp{think: 5 * time.Millisecond}, rnd, time.Now()); d != 5*time.Millisecond {
+		t.Errorf("pause of the operation with its think time is %v, want 5ms", d)
+	}
+}
@@ -0,0 +1,321 @@
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Threshold is a pass/fail criterion such as "p99<50ms", "error_rate<0.1%" or "reads:rps>2000".
+type Threshold struct {
+	// Op limits the threshold to the results of a single operation, the totals are checked if it is empty.
+	Op     string
+	Metric string
+	Cmp    string
+	// Value is in seconds for the latency metrics and a fraction for the rates.
+	Value float64
+}
+
+const (
+	metricRPS       = "rps"
+	metricErrorRate = "error_rate"
+	metricDropRate  = "dropped_rate"
+)
+
+var latencyMetrics = map[string]func(loadTestResult) time.Duration{
+	"min":   func(r loadTestResult) time.Duration { return r.Latency.Min() },
+	"mean":  func(r loadTestResult) time.Duration { return r.Latency.Mean() },
+	"p50":   func(r loadTestResult) time.Duration { return r.Latency.Quantile(0.5) },
+	"p90":   func(r loadTestResult) time.Duration { return r.Latency.Quantile(0.9) },
+	"p95":   func(r loadTestResult) time.Duration { return r.Latency.Quantile(0.95) },
+	"p99":   func(r loadTestResult) time.Duration { return r.Latency.Quantile(0.99) },
+	"p99.9": func(r loadTestResult) time.Duration { return r.Latency.Quantile(0.999) },
+	"max":   func(r loadTestResult) time.Duration { return r.Latency.Max() },
+}
+
+func isRateMetric(m string) bool {
+	return m == metricErrorRate || m == metricDropRate
+}
+
+// ParseThresholds parses the comma-separated list of thresholds.
+func ParseThresholds(s string) ([]Threshold, error) {
+	var ts []Threshold
+	for _, part := range strings.Split(s, ",") {
+		t, err := ParseThreshold(part)
+		if err != nil {
+			return nil, err
+		}
+		ts = append(ts, t)
+	}
+	return ts, nil
+}
+
+func ParseThreshold(s string) (Threshold, error) {
+	s = strings.TrimSpace(s)
+	idx := strings.IndexAny(s, "<>")
+	if idx < 0 {
+		return Threshold{}, fmt.Errorf("threshold %q: expected metric<value or metric>value", s)
+	}
+	t := Threshold{
+		Metric: strings.TrimSpace(s[:idx]),
+		Cmp:    s[idx : idx+1],
+	}
+	value := s[idx+1:]
+	if strings.HasPrefix(value, "=") {
+		t.Cmp += "="
+		value = value[1:]
+	}
+	value = strings.TrimSpace(value)
+	if op, metric, ok := strings.Cut(t.Metric, ":"); ok {
+		t.Op, t.Metric = op, metric
+	}
+
+	var err error
+	switch {
+	case t.Metric == metricRPS:
+		t.Value, err = strconv.ParseFloat(value, 64)
+	case isRateMetric(t.Metric):
+		t.Value, err = parseRate(value)
+	case latencyMetrics[t.Metric] != nil:
+		var d time.Duration
+		d, err = time.ParseDuration(value)
+		t.Value = d.Seconds()
+	default:
+		return Threshold{}, fmt.Errorf("threshold %q: unknown metric %q", s, t.Metric)
+	}
+	if err != nil {
+		return Threshold{}, fmt.Errorf("threshold %q: failed to parse the value: %w", s, err)
+	}
+	return t, nil
+}
+
+// parseRate parses either a fraction ("0.001") or a percentage ("0.1%").
+func parseRate(s string) (float64, error) {
+	if p, ok := strings.CutSuffix(s, "%"); ok {
+		v, err := strconv.ParseFloat(p, 64)
+		return v / 100, err
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func (t Threshold) String() string {
+	metric := t.Metric
+	if t.Op != "" {
+		metric = t.Op + ":" + metric
+	}
+	return metric + t.Cmp + t.formatValue(t.Value)
+}
+
+func (t Threshold) formatValue(v float64) string {
+	switch {
+	case t.Metric == metricRPS:
+		return strconv.FormatFloat(v, 'f', 1, 64)
+	case isRateMetric(t.Metric):
+		return strconv.FormatFloat(v*100, 'g', 4, 64) + "%"
+	default:
+		return time.Duration(v * float64(time.Second)).String()
+	}
+}
+
+type thresholdResult struct {
+	Threshold Threshold
+	Actual    float64
+	Passed    bool
+	// Missing is set if there are no results for the threshold operation.
+	Missing bool
+}
+
+func (r thresholdResult) String() string {
+	status := "passed"
+	if !r.Passed {
+		status = "FAILED"
+	}
+	if r.Missing {
+		return fmt.Sprintf("%s: %s (no results for operation %q)", r.Threshold, status, r.Threshold.Op)
+	}
+	return fmt.Sprintf("%s: %s (actual %s)", r.Threshold, status, r.Threshold.formatValue(r.Actual))
+}
+
+func (t Threshold) check(res loadTestResult) thresholdResult {
+	if t.Op != "" {
+		o, ok := res.Operations[t.Op]
+		if !ok {
+			return thresholdResult{Threshold: t, Missing: true}
+		}
+		res = *o
+	}
+	actual := t.actual(res)
+	return thresholdResult{
+		Threshold: t,
+		Actual:    actual,
+		Passed:    compare(actual, t.Cmp, t.Value),
+	}
+}
+
+func (t Threshold) actual(res loadTestResult) float64 {
+	switch t.Metric {
+	case metricRPS:
+		return res.OpsPerSecond()
+	case metricErrorRate:
+		return res.ErrorRate()
+	case metricDropRate:
+		if res.Scheduled == 0 {
+			return 0
+		}
+		return float64(res.Dropped) / float64(res.Scheduled)
+	default:
+		return latencyMetrics[t.Metric](res).Seconds()
+	}
+}
+
+func compare(actual float64, cmp string, value float64) bool {
+	switch cmp {
+	case "<":
+		return actual < value
+	case "<=":
+		return actual <= value
+	case ">":
+		return actual > value
+	default:
+		return actual >= value
+	}
+}
+
+func checkThresholds(ts []Threshold, res loadTestResult) []thresholdResult {
+	results := make([]thresholdResult, 0, len(ts))
+	for _, t := range ts {
+		results = append(results, t.check(res))
+	}
+	return results
+}
+
+// irrecoverable reports whether the threshold is going to fail whatever the rest of the test brings.
+// planned is the upper bound of the number of requests of the whole test, zero if it is unknown,
+// then only the max latency can be judged.
+func (t Threshold) irrecoverable(s liveSnapshot, planned int64) bool {
+	if t.Op != "" || s.Latency == nil {
+		return false
+	}
+	limit := time.Duration(t.Value * float64(time.Second))
+	above := func() int64 {
+		n := s.Latency.CountAbove(limit)
+		if t.Cmp == "<" && limit > 0 {
+			// a value equal to the limit fails the strict comparison as well
+			n = s.Latency.CountAbove(limit - time.Microsecond)
+		}
+		return n
+	}
+	switch {
+	case t.Cmp != "<" && t.Cmp != "<=":
+		return false
+	case t.Metric == "max":
+		return above() > 0
+	case planned == 0:
+		return false
+	case t.Metric == metricErrorRate:
+		return !compare(float64(s.Errors)/float64(planned), t.Cmp, t.Value)
+	}
+	q, ok := latencyQuantiles[t.Metric]
+	if !ok {
+		return false
+	}
+	// the quantile is above the limit if there are more slow values than the ones allowed to be above it
+	allowed := planned - int64(math.Ceil(q*float64(planned)))
+	return above() > allowed
+}
+
+var latencyQuantiles = map[string]float64{
+	"p50":   0.5,
+	"p90":   0.9,
+	"p95":   0.95,
+	"p99":   0.99,
+	"p99.9": 0.999,
+}
+
+// thresholdCheckInterval is how often the thresholds are checked while the test is running.
+const thresholdCheckInterval = time.Second
+
+// watchThresholds aborts the test as soon as any threshold is irrecoverably breached.
+// The requests made during the warm-up are not taken into account.
+func watchThresholds(
+	ctx context.Context,
+	wg *sync.WaitGroup,
+	ts []Threshold,
+	live *liveStats,
+	planned int64,
+	warmup time.Duration,
+	abort context.CancelFunc,
+) {
+	defer wg.Done()
+	if !sleep(ctx, warmup) {
+		return
+	}
+	base := live.snapshot()
+	ticker := time.NewTicker(thresholdCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s := live.snapshot()
+		s.Ops -= base.Ops
+		s.Errors -= base.Errors
+		s.Latency = s.Latency.Sub(base.Latency)
+		for _, t := range ts {
+			if t.irrecoverable(s, planned) {
+				log.Printf("threshold %v is irrecoverably breached, aborting the test", t)
+				abort()
+				return
+			}
+		}
+	}
+}
+
+// plannedRequests returns the number of requests the open model is going to send,
+// zero for the closed model where it is unknown.
+func plannedRequests(cfg Config) int64 {
+	if len(cfg.Stages) > 0 {
+		if cfg.StagesTarget != StageTargetRate {
+			return 0
+		}
+		var n float64
+		for _, s := range cfg.Stages {
+			n += float64(s.From+s.To) / 2 * s.Duration.Seconds()
+		}
+		return int64(math.Ceil(n))
+	}
+	return int64(math.Ceil(float64(cfg.Rate) * cfg.Duration.Seconds()))
+}
+
+type thresholdsError struct {
+	Failed []thresholdResult
+	Total  int
+}
+
+func (e *thresholdsError) Error() string {
+	parts := make([]string, 0, len(e.Failed))
+	for _, r := range e.Failed {
+		parts = append(parts, r.String())
+	}
+	return fmt.Sprintf("%d of %d thresholds failed: %s", len(e.Failed), e.Total, strings.Join(parts, "; "))
+}
+
+func failedThresholds(results []thresholdResult) error {
+	var failed []thresholdResult
+	for _, r := range results {
+		if !r.Passed {
+			failed = append(failed, r)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return &thresholdsError{Failed: failed, Total: len(results)}
+}
@@ -0,0 +1,65 @@
+package loadgen
+
+import (
+	"testing"
+	"time"
+
+	"loadgen/internal/stats"
+)
+
+func TestThresholdIrrecoverable(t *testing.T) {
+	h := stats.NewHistogram()
+	for i := 0; i < 90; i++ {
+		h.Record(time.Millisecond)
+	}
+	for i := 0; i < 10; i++ {
+		h.Record(time.Second)
+	}
+	s := liveSnapshot{Ops: 100, Errors: 5, Latency: h}
+
+	tests := []struct {
+		threshold string
+		planned   int64
+		want      bool
+	}{
+		{"max<500ms", 0, true},
+		{"max<2s", 0, false},
+		{"max<=1s", 0, false},
+		{"max<990ms", 0, true},
+		// the rest of the closed model test may bring any number of fast requests
+		{"p99<500ms", 0, false},
+		{"error_rate<1%", 0, false},
+		// 10 slow requests out of at most 1000 keep p99 below, out of at most 500 they do not
+		{"p99<500ms", 1000, false},
+		{"p99<500ms", 500, true},
+		{"error_rate<1%", 1000, false},
+		{"error_rate<1%", 500, true},
+		{"rps>1000", 500, false},
+		{"reads:max<500ms", 0, false},
+	}
+	for _, tt := range tests {
+		th, err := ParseThreshold(tt.threshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := th.irrecoverable(s, tt.planned); got != tt.want {
+			t.Errorf("%s with %d planned requests: irrecoverable = %v, want %v", tt.threshold, tt.planned, got, tt.want)
+		}
+	}
+}
+
+func TestPlannedRequests(t *testing.T) {
+	if n := plannedRequests(Config{Rate: 100, Duration: time.Second * 10}); n != 1000 {
+		t.Errorf("fixed rate: got %d, want 1000", n)
+	}
+	stages := []Stage{{Duration: time.Second * 10, From: 0, To: 100}, {Duration: time.Second * 5, From: 100, To: 100}}
+	if n := plannedRequests(Config{Stages: stages, StagesTarget: StageTargetRate}); n != 1000 {
+		t.Errorf("rate stages: got %d, want 1000", n)
+	}
+	if n := plannedRequests(Config{Stages: stages, StagesTarget: StageTargetWorkers}); n != 0 {
+		t.Errorf("worker stages: got %d, want 0", n)
+	}
+	if n := plannedRequests(Config{WorkersCount: 10, Duration: time.Second}); n != 0 {
+		t.Errorf("closed model: got %d, want 0", n)
+	}
+}
@@ -0,0 +1,164 @@
+package loadgen
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"loadgen/internal/stats"
+)
+
+// requestTrace collects the moments of the connection phases of a single request.
+// The hooks may be called from the dialing goroutine even after the request is done,
+// hence the mutex.
+type requestTrace struct {
+	mux *sync.Mutex
+
+	getConn, gotConn         time.Time
+	dnsStart, dnsDone        time.Time
+	connectStart, connectEnd time.Time
+	tlsStart, tlsDone        time.Time
+	wroteRequest, firstByte  time.Time
+	done                     time.Time
+	gotConnInfo              bool
+	reused                   bool
+}
+
+func newRequestTrace() *requestTrace {
+	return &requestTrace{mux: &sync.Mutex{}}
+}
+
+type traceKey struct{}
+
+// withTrace returns the context which makes the HTTP client report to the trace.
+func (t *requestTrace) withTrace(ctx context.Context) context.Context {
+	ctx = context.WithValue(ctx, traceKey{}, t)
+	now := func(dst *time.Time) {
+		t.mux.Lock()
+		defer t.mux.Unlock()
+		if dst.IsZero() {
+			*dst = time.Now()
+		}
+	}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn: func(string) { now(&t.getConn) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			now(&t.gotConn)
+			t.mux.Lock()
+			defer t.mux.Unlock()
+			t.gotConnInfo = true
+			t.reused = info.Reused
+		},
+		DNSStart:             func(httptrace.DNSStartInfo) { now(&t.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { now(&t.dnsDone) },
+		ConnectStart:         func(string, string) { now(&t.connectStart) },
+		ConnectDone:          func(string, string, error) { now(&t.connectEnd) },
+		TLSHandshakeStart:    func() { now(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { now(&t.tlsDone) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { now(&t.wroteRequest) },
+		GotFirstResponseByte: func() { now(&t.firstByte) },
+	})
+}
+
+// finishTrace marks the moment the response body of the traced request has been read.
+func finishTrace(ctx context.Context) {
+	if t, ok := ctx.Value(traceKey{}).(*requestTrace); ok {
+		t.finish()
+	}
+}
+
+func (t *requestTrace) finish() {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.done = time.Now()
+}
+
+// phaseStats breaks the request latency down by the connection phases.
+type phaseStats struct {
+	DNS     *stats.Histogram
+	Connect *stats.Histogram
+	TLS     *stats.Histogram
+	// ConnWait is the time it took to get a connection: the pool wait for a reused one,
+	// or DNS, connect and TLS for a new one.
+	ConnWait *stats.Histogram
+	// TTFB is the time between the request is written and the first response byte, mostly the server time.
+	TTFB     *stats.Histogram
+	BodyRead *stats.Histogram
+	// ReusedConns and NewConns count the requests sent over the kept-alive and the new connections.
+	ReusedConns int64
+	NewConns    int64
+}
+
+func newPhaseStats() phaseStats {
+	return phaseStats{
+		DNS:      stats.NewHistogram(),
+		Connect:  stats.NewHistogram(),
+		TLS:      stats.NewHistogram(),
+		ConnWait: stats.NewHistogram(),
+		TTFB:     stats.NewHistogram(),
+		BodyRead: stats.NewHistogram(),
+	}
+}
+
+func (s *phaseStats) record(t *requestTrace) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if !t.gotConnInfo {
+		return
+	}
+	if t.reused {
+		s.ReusedConns++
+	} else {
+		s.NewConns++
+	}
+	span := func(h *stats.Histogram, start, end time.Time) {
+		if !start.IsZero() && !end.IsZero() && !end.Before(start) {
+			h.Record(end.Sub(start))
+		}
+	}
+	span(s.DNS, t.dnsStart, t.dnsDone)
+	span(s.Connect, t.connectStart, t.connectEnd)
+	span(s.TLS, t.tlsStart, t.tlsDone)
+	span(s.ConnWait, t.getConn, t.gotConn)
+	span(s.TTFB, t.wroteRequest, t.firstByte)
+	span(s.BodyRead, t.firstByte, t.done)
+}
+
+func (s *phaseStats) merge(o phaseStats) {
+	s.DNS.Merge(o.DNS)
+	s.Connect.Merge(o.Connect)
+	s.TLS.Merge(o.TLS)
+	s.ConnWait.Merge(o.ConnWait)
+	s.TTFB.Merge(o.TTFB)
+	s.BodyRead.Merge(o.BodyRead)
+	s.ReusedConns += o.ReusedConns
+	s.NewConns += o.NewConns
+}
+
+// ReuseRatio is the share of the requests sent over a kept-alive connection.
+func (s phaseStats) ReuseRatio() float64 {
+	total := s.ReusedConns + s.NewConns
+	if total == 0 {
+		return 0
+	}
+	return float64(s.ReusedConns) / float64(total)
+}
+
+// phases returns the phase histograms in the reporting order.
+func (s phaseStats) phases() []namedHistogram {
+	return []namedHistogram{
+		{"dns", s.DNS},
+		{"connect", s.Connect},
+		{"tls", s.TLS},
+		{"conn_wait", s.ConnWait},
+		{"ttfb", s.TTFB},
+		{"body_read", s.BodyRead},
+	}
+}
+
+type namedHistogram struct {
+	Name string
+	Hist *stats.Histogram
+}
@@ -0,0 +1,63 @@
+package loadgen
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPhaseStats(t *testing.T) {
+	const (
+		serverTime = 20 * time.Millisecond
+		bodyTime   = 20 * time.Millisecond
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(serverTime)
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(bodyTime)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+	c, err := newClient(newTestConfig(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	s := newPhaseStats()
+	const requests = 3
+	for i := 0; i < requests; i++ {
+		tr := newRequestTrace()
+		if _, err := c.FindByEmail(tr.withTrace(context.Background()), "a@gopher-corp.com"); err != nil {
+			t.Fatal(err)
+		}
+		s.record(tr)
+	}
+
+	// the requests are sequential, so the connection of the first one is reused by the rest
+	if s.NewConns != 1 || s.ReusedConns != requests-1 {
+		t.Errorf("%d new and %d reused connections, want 1 and %d", s.NewConns, s.ReusedConns, requests-1)
+	}
+	if r := s.ReuseRatio(); r != float64(requests-1)/requests {
+		t.Errorf("reuse ratio %v", r)
+	}
+	if n := s.Connect.Count(); n != 1 {
+		t.Errorf("%d connects recorded, want 1", n)
+	}
+	minDuration := map[string]time.Duration{"ttfb": serverTime, "body_read": bodyTime}
+	for _, ph := range s.phases() {
+		atLeast, ok := minDuration[ph.Name]
+		if !ok {
+			continue
+		}
+		if n := ph.Hist.Count(); n != requests {
+			t.Errorf("%s: %d samples, want %d", ph.Name, n, requests)
+		}
+		if m := ph.Hist.Min(); m < atLeast {
+			t.Errorf("%s: min %v, want at least %v", ph.Name, m, atLeast)
+		}
+	}
+}
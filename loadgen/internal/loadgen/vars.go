@@ -0,0 +1,143 @@
+package loadgen
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+
+	"loadgen/internal/common"
+)
+
+const (
+	varFirstName = "first_name"
+	varLastName  = "last_name"
+	varEmail     = "email"
+	varSalary    = "salary"
+	varPosition  = "position"
+)
+
+func isBuiltinVar(name string) bool {
+	switch name {
+	case varFirstName, varLastName, varEmail, varSalary, varPosition:
+		return true
+	}
+	return false
+}
+
+// positions are the titles created by datagen, the app rejects employees with other positions.
+var positions = []string{
+	"Accountant", "Developer", "QA", "Designer", "PM",
+}
+
+const maxSalary = 200000
+
+// requestVars provides the values of the placeholders for a single request:
+// the name fetched by the dispatcher and the email derived from it, random salary
+// and position, and the columns of a random row of the data file. The lookups take
+// the email from the email source instead.
+type requestVars struct {
+	name   common.Name
+	rnd    *rand.Rand
+	data   *dataSet
+	row    []string
+	emails *emailSource
+	// lookupEmail is picked once, so that all the placeholders of the request refer to the same employee
+	lookupEmail string
+	// lookupKey is the index of the lookupEmail in the email source, -1 if it is not from the key space.
+	lookupKey int
+}
+
+func newRequestVars(n common.Name, rnd *rand.Rand, data *dataSet, emails *emailSource) *requestVars {
+	v := &requestVars{
+		name:      n,
+		rnd:       rnd,
+		data:      data,
+		emails:    emails,
+		lookupKey: -1,
+	}
+	if data != nil && len(data.rows) > 0 {
+		v.row = data.rows[rnd.Intn(len(data.rows))]
+	}
+	return v
+}
+
+func (v *requestVars) get(name string) string {
+	switch name {
+	case varFirstName:
+		return v.name.FirstName
+	case varLastName:
+		return v.name.LastName
+	case varEmail:
+		return emailFromName(v.name)
+	case varSalary:
+		return strconv.Itoa(v.rnd.Intn(maxSalary) + 1)
+	case varPosition:
+		return positions[v.rnd.Intn(len(positions))]
+	}
+	if idx, ok := v.data.columnIndex(name); ok && v.row != nil {
+		return v.row[idx]
+	}
+	return ""
+}
+
+// getLookup is get for the lookups: the email is picked by the email source, so that the share
+// of the hits and the key distribution apply. The writes keep the email matching the name,
+// otherwise they would duplicate the existing employees.
+func (v *requestVars) getLookup(name string) string {
+	if name != varEmail {
+		return v.get(name)
+	}
+	if v.lookupEmail == "" {
+		v.lookupEmail, v.lookupKey = v.emails.pick(v.rnd, v.name)
+	}
+	return v.lookupEmail
+}
+
+// dataSet is a CSV file with a header, every column can be used as a placeholder.
+type dataSet struct {
+	columns map[string]int
+	rows    [][]string
+}
+
+func loadDataSet(path string) (*dataSet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the data file: %w", err)
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the data file: %w", err)
+	}
+	if len(records) < 2 {
+		return nil, errors.New("data file should contain a header and at least one row")
+	}
+	d := &dataSet{
+		columns: make(map[string]int, len(records[0])),
+		rows:    records[1:],
+	}
+	for i, c := range records[0] {
+		if isBuiltinVar(c) {
+			return nil, fmt.Errorf("data file column %q clashes with a built-in placeholder", c)
+		}
+		d.columns[c] = i
+	}
+	return d, nil
+}
+
+func (d *dataSet) hasColumn(name string) bool {
+	_, ok := d.columnIndex(name)
+	return ok
+}
+
+func (d *dataSet) columnIndex(name string) (int, bool) {
+	if d == nil {
+		return 0, false
+	}
+	idx, ok := d.columns[name]
+	return idx, ok
+}
@@ -0,0 +1,68 @@
+package loadgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// VerifyEmployee makes the operation check that a 200 response is the employee with the requested email.
+const VerifyEmployee = "employee"
+
+// employee mirrors the model.Employee of the app, a response with other fields is a mismatch.
+type employee struct {
+	FirstName *string  `json:"first_name"`
+	LastName  *string  `json:"last_name"`
+	Salary    *float64 `json:"salary"`
+	Position  *string  `json:"position"`
+	Email     *string  `json:"email"`
+}
+
+// verificationError is a correctness error: the response has been received but its body is wrong.
+type verificationError struct {
+	Reason string
+	Detail string
+}
+
+func (e *verificationError) Error() string {
+	return fmt.Sprintf("response verification has failed: %s: %s", e.Reason, e.Detail)
+}
+
+const (
+	verifyReasonShape = "invalid employee"
+	verifyReasonEmail = "email mismatch"
+)
+
+// verifyEmployee checks the body of the employee-by-email response.
+func verifyEmployee(body []byte, email string) error {
+	var e employee
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&e); err != nil {
+		return &verificationError{Reason: verifyReasonShape, Detail: err.Error()}
+	}
+	switch {
+	case e.FirstName == nil, e.LastName == nil, e.Salary == nil, e.Position == nil, e.Email == nil:
+		return &verificationError{Reason: verifyReasonShape, Detail: fmt.Sprintf("missing fields in %s", body)}
+	case *e.FirstName == "" || *e.LastName == "" || *e.Position == "":
+		return &verificationError{Reason: verifyReasonShape, Detail: fmt.Sprintf("empty fields in %s", body)}
+	case *e.Email != email:
+		return &verificationError{Reason: verifyReasonEmail, Detail: fmt.Sprintf("requested %q, got %q", email, *e.Email)}
+	}
+	return nil
+}
+
+func (s RequestSpec) validateVerify(path *template) error {
+	switch s.Verify {
+	case "":
+		return nil
+	case VerifyEmployee:
+		if s.Method != http.MethodGet || !path.hasVar(varEmail) {
+			return fmt.Errorf("%s verification requires a GET request with {{%s}} in the path", s.Verify, varEmail)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown verification %q", s.Verify)
+	}
+}
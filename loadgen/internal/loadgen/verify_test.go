@@ -0,0 +1,33 @@
+package loadgen
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVerifyEmployee(t *testing.T) {
+	const email = "Rob.Pike@gopher-corp.com"
+	tests := []struct {
+		body   string
+		reason string
+	}{
+		{`{"first_name":"Rob","last_name":"Pike","salary":100,"position":"Developer","email":"Rob.Pike@gopher-corp.com"}`, ""},
+		{`{"first_name":"Ken","last_name":"Thompson","salary":100,"position":"Developer","email":"Ken.Thompson@gopher-corp.com"}`, verifyReasonEmail},
+		{`{"first_name":"Rob","last_name":"Pike","position":"Developer","email":"Rob.Pike@gopher-corp.com"}`, verifyReasonShape},
+		{`{"first_name":"","last_name":"Pike","salary":100,"position":"Developer","email":"Rob.Pike@gopher-corp.com"}`, verifyReasonShape},
+		{`{"first_name":"Rob","last_name":"Pike","salary":"100","position":"Developer","email":"Rob.Pike@gopher-corp.com"}`, verifyReasonShape},
+		{`{"name":"Rob"}`, verifyReasonShape},
+		{`<html>`, verifyReasonShape},
+		{``, verifyReasonShape},
+	}
+	for _, tt := range tests {
+		err := verifyEmployee([]byte(tt.body), email)
+		var verr *verificationError
+		switch {
+		case tt.reason == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", tt.body, err)
+		case tt.reason != "" && (!errors.As(err, &verr) || verr.Reason != tt.reason):
+			t.Errorf("%s: got %v, want a %q verification error", tt.body, err, tt.reason)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	OpReads  = "reads"
+	OpWrites = "writes"
+)
+
+// OpWeight is the relative share of a built-in operation in the workload.
+type OpWeight struct {
+	Op     string
+	Weight int
+}
+
+func DefaultWorkload() []OpWeight {
+	return []OpWeight{{Op: OpReads, Weight: 1}}
+}
+
+// ParseWorkload parses the comma-separated list of weighted operations, e.g. "reads=90,writes=10".
+func ParseWorkload(s string) ([]OpWeight, error) {
+	var w []OpWeight
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ",") {
+		op, weight, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("expected the op=weight format, got %q", part)
+		}
+		if op != OpReads && op != OpWrites {
+			return nil, fmt.Errorf("unknown operation %q, known operations: %s, %s", op, OpReads, OpWrites)
+		}
+		if seen[op] {
+			return nil, fmt.Errorf("operation %q is listed more than once", op)
+		}
+		seen[op] = true
+		wt, err := strconv.Atoi(weight)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the weight of %q: %w", op, err)
+		}
+		if wt < 0 {
+			return nil, fmt.Errorf("weight of %q should not be negative, got %d", op, wt)
+		}
+		w = append(w, OpWeight{Op: op, Weight: wt})
+	}
+	return w, nil
+}
+
+// IsReadOnlyWorkload reports whether the workload consists of lookups only.
+func IsReadOnlyWorkload(w []OpWeight) bool {
+	for _, ow := range w {
+		if ow.Op != OpReads && ow.Weight > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestSpec describes a kind of request the load generator sends.
+// Path, Body and header values may contain placeholders, see requestVars.
+type RequestSpec struct {
+	Name    string
+	Method  string
+	Path    string
+	Body    string
+	Headers map[string]string
+	Weight  int
+	// Expect lists the status codes treated as a success, any 2xx code is fine if it is empty.
+	Expect []int
+	// ThinkTime is the pause a closed-model worker makes after the request.
+	ThinkTime time.Duration
+	// Verify is the kind of the response body verification, the body is not read if it is empty.
+	Verify string
+}
+
+const employeeBodyTemplate = `{"first_name":"{{first_name}}","last_name":"{{last_name}}",` +
+	`"salary":{{salary}},"position":"{{position}}","email":"{{email}}"}`
+
+// DefaultRequests converts the built-in operations to the request specs.
+func DefaultRequests(w []OpWeight, cfg HTTPConfig) []RequestSpec {
+	specs := make([]RequestSpec, 0, len(w))
+	for _, ow := range w {
+		switch ow.Op {
+		case OpReads:
+			specs = append(specs, RequestSpec{
+				Name:   OpReads,
+				Method: http.MethodGet,
+				Path:   strings.TrimSuffix(cfg.EmailEndpoint, "/") + "/{{email}}",
+				Weight: ow.Weight,
+				Expect: []int{http.StatusOK, http.StatusNotFound},
+			})
+		case OpWrites:
+			specs = append(specs, RequestSpec{
+				Name:    OpWrites,
+				Method:  http.MethodPost,
+				Path:    cfg.EmployeeEndpoint,
+				Body:    employeeBodyTemplate,
+				Headers: map[string]string{"Content-Type": "application/json"},
+				Weight:  ow.Weight,
+				Expect:  []int{http.StatusCreated},
+			})
+		}
+	}
+	return specs
+}
+
+var knownMethods = map[string]bool{
+	http.MethodGet:    true,
+	http.MethodHead:   true,
+	http.MethodPost:   true,
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+func (s RequestSpec) validate() error {
+	if s.Name == "" {
+		return errors.New("name should not be empty")
+	}
+	if !knownMethods[s.Method] {
+		return fmt.Errorf("unsupported method %q", s.Method)
+	}
+	if !strings.HasPrefix(s.Path, "/") {
+		return fmt.Errorf("path should start with /, got %q", s.Path)
+	}
+	if s.Weight < 0 {
+		return fmt.Errorf("weight should not be negative, got %d", s.Weight)
+	}
+	for _, code := range s.Expect {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("invalid expected status code %d", code)
+		}
+	}
+	if s.ThinkTime < 0 {
+		return fmt.Errorf("think time should not be negative, got %v", s.ThinkTime)
+	}
+	return nil
+}
+
+// operation is a kind of request the load generator can send.
+type operation interface {
+	name() string
+	// do sends a request built from the variables and returns the response status code
+	// and an error if the operation has not succeeded.
+	do(ctx context.Context, c *client, v *requestVars) (int, error)
+	thinkTime() time.Duration
+}
+
+type unexpectedStatusError struct {
+	Code int
+}
+
+func (e *unexpectedStatusError) Error() string {
+	return fmt.Sprintf("an unexpected status code received: %d", e.Code)
+}
+
+// templateOp is an operation built from a RequestSpec.
+type templateOp struct {
+	spec    RequestSpec
+	path    *template
+	body    *template
+	headers map[string]*template
+	// bodyEscape escapes the placeholder values in the body according to its content type.
+	bodyEscape escapeFunc
+	// lookup is set for the GET requests with the email in the path, only they use the key source.
+	lookup bool
+}
+
+func newTemplateOp(spec RequestSpec, data *dataSet) (*templateOp, error) {
+	if err := spec.validate(); err != nil {
+		return nil, err
+	}
+	known := func(name string) bool {
+		return isBuiltinVar(name) || data.hasColumn(name)
+	}
+	op := &templateOp{
+		spec:       spec,
+		headers:    make(map[string]*template, len(spec.Headers)),
+		bodyEscape: escapeNone,
+	}
+	var err error
+	if op.path, err = parseTemplate(spec.Path, known); err != nil {
+		return nil, fmt.Errorf("path: %w", err)
+	}
+	if err := spec.validateVerify(op.path); err != nil {
+		return nil, err
+	}
+	op.lookup = spec.Method == http.MethodGet && op.path.hasVar(varEmail)
+	if op.body, err = parseTemplate(spec.Body, known); err != nil {
+		return nil, fmt.Errorf("body: %w", err)
+	}
+	for k, v := range spec.Headers {
+		if op.headers[k], err = parseTemplate(v, known); err != nil {
+			return nil, fmt.Errorf("header %s: %w", k, err)
+		}
+		if strings.EqualFold(k, "Content-Type") && strings.Contains(v, "json") {
+			op.bodyEscape = escapeJSON
+		}
+	}
+	return op, nil
+}
+
+func (op *templateOp) name() string {
+	return op.spec.Name
+}
+
+func (op *templateOp) thinkTime() time.Duration {
+	return op.spec.ThinkTime
+}
+
+func (op *templateOp) do(ctx context.Context, c *client, v *requestVars) (int, error) {
+	get := v.get
+	if op.lookup {
+		get = v.getLookup
+	}
+	sb := &strings.Builder{}
+	op.path.render(sb, get, escapePath)
+	path := sb.String()
+
+	var body []byte
+	if !op.body.isEmpty() {
+		sb.Reset()
+		op.body.render(sb, get, op.bodyEscape)
+		body = []byte(sb.String())
+	}
+
+	var headers http.Header
+	if len(op.headers) > 0 {
+		headers = make(http.Header, len(op.headers))
+		for k, t := range op.headers {
+			sb.Reset()
+			t.render(sb, get, escapeNone)
+			headers.Set(k, sb.String())
+		}
+	}
+
+	var respBody *bytes.Buffer
+	if op.spec.Verify != "" {
+		respBody = &bytes.Buffer{}
+	}
+	code, err := c.send(ctx, op.spec.Method, path, body, headers, respBody)
+	if err != nil {
+		return code, err
+	}
+	if !op.expected(code) {
+		return code, &unexpectedStatusError{Code: code}
+	}
+	if op.spec.Verify == VerifyEmployee && code == http.StatusOK {
+		if err := verifyEmployee(respBody.Bytes(), get(varEmail)); err != nil {
+			return code, err
+		}
+	}
+	return code, nil
+}
+
+func (op *templateOp) expected(code int) bool {
+	if len(op.spec.Expect) == 0 {
+		return code >= 200 && code < 300
+	}
+	for _, c := range op.spec.Expect {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// mix picks the operations randomly according to their weights.
+type mix struct {
+	ops []operation
+	// cumulative[i] is the sum of the weights of ops[0..i].
+	cumulative []int
+}
+
+func newMix(specs []RequestSpec, data *dataSet) (*mix, error) {
+	if len(specs) == 0 {
+		return nil, errors.New("no requests to send")
+	}
+	m := &mix{}
+	total := 0
+	names := make(map[string]bool, len(specs))
+	for i, spec := range specs {
+		op, err := newTemplateOp(spec, data)
+		if err != nil {
+			return nil, fmt.Errorf("request #%d (%s): %w", i+1, spec.Name, err)
+		}
+		if names[spec.Name] {
+			return nil, fmt.Errorf("request #%d: name %q is not unique", i+1, spec.Name)
+		}
+		names[spec.Name] = true
+		if spec.Weight == 0 {
+			continue
+		}
+		total += spec.Weight
+		m.ops = append(m.ops, op)
+		m.cumulative = append(m.cumulative, total)
+	}
+	if total == 0 {
+		return nil, errors.New("total weight of the requests should be greater than 0")
+	}
+	return m, nil
+}
+
+func (m *mix) pick(rnd *rand.Rand) operation {
+	if len(m.ops) == 1 {
+		return m.ops[0]
+	}
+	v := rnd.Intn(m.cumulative[len(m.cumulative)-1])
+	idx := sort.SearchInts(m.cumulative, v+1)
+	return m.ops[idx]
+}
@@ -0,0 +1,194 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"text/tabwriter"
+)
+
+type CompareOptions struct {
+	// Tolerance is the relative change (e.g. 0.05 for 5%) below which differences are ignored.
+	Tolerance float64
+	// Alpha is the significance level of the statistical tests.
+	Alpha float64
+	// UntestedTolerance is the relative change above which the metrics without a significance test
+	// (throughput and percentiles) are reported as regressions. Zero disables it: the change of
+	// such metrics may be noise, so they are only marked as untested.
+	UntestedTolerance float64
+}
+
+type Delta struct {
+	Scope  string
+	Metric string
+	Old    float64
+	New    float64
+	// Change is relative to Old, it is +Inf if Old is zero and New is not.
+	Change float64
+	// PValue is set for the metrics which can be tested for significance, NaN otherwise.
+	PValue float64
+	// Untested is set if the change is in the bad direction and exceeds the tolerance,
+	// but the metric cannot be tested for significance.
+	Untested   bool
+	Regression bool
+}
+
+// Compare compares the totals and the operations present in both reports.
+// A change is reported as a regression if it is in the bad direction, exceeds the tolerance
+// and is statistically significant. The metrics without a known variance (throughput and percentiles)
+// are only reported as regressions if the change exceeds UntestedTolerance.
+func Compare(oldRep, newRep *Report, opts CompareOptions) []Delta {
+	deltas := compareStats("total", oldRep.Total, newRep.Total, opts)
+	for _, name := range SortedKeys(oldRep.Operations) {
+		n, ok := newRep.Operations[name]
+		if !ok {
+			continue
+		}
+		deltas = append(deltas, compareStats(name, oldRep.Operations[name], n, opts)...)
+	}
+	return deltas
+}
+
+func compareStats(scope string, o, n Stats, opts CompareOptions) []Delta {
+	type metric struct {
+		name           string
+		old, new       float64
+		higherIsBetter bool
+		pValue         float64
+	}
+	metrics := []metric{
+		{name: "ops_per_second", old: o.OpsPerSecond, new: n.OpsPerSecond, higherIsBetter: true, pValue: math.NaN()},
+		{
+			name: "error_rate", old: o.ErrorRate, new: n.ErrorRate,
+			pValue: twoProportionPValue(o.Errors, o.Ops+o.Errors, n.Errors, n.Ops+n.Errors),
+		},
+		{
+			name: "mean_ms", old: o.Latency.MeanMs, new: n.Latency.MeanMs,
+			pValue: welchPValue(o.Latency, n.Latency),
+		},
+		{name: "p50_ms", old: o.Latency.P50Ms, new: n.Latency.P50Ms, pValue: math.NaN()},
+		{name: "p90_ms", old: o.Latency.P90Ms, new: n.Latency.P90Ms, pValue: math.NaN()},
+		{name: "p99_ms", old: o.Latency.P99Ms, new: n.Latency.P99Ms, pValue: math.NaN()},
+		{name: "p99_9_ms", old: o.Latency.P999Ms, new: n.Latency.P999Ms, pValue: math.NaN()},
+	}
+	if o.Scheduled > 0 && n.Scheduled > 0 {
+		metrics = append(metrics, metric{
+			name:   "dropped_rate",
+			old:    float64(o.Dropped) / float64(o.Scheduled),
+			new:    float64(n.Dropped) / float64(n.Scheduled),
+			pValue: twoProportionPValue(o.Dropped, o.Scheduled, n.Dropped, n.Scheduled),
+		})
+	}
+
+	deltas := make([]Delta, 0, len(metrics))
+	for _, m := range metrics {
+		d := Delta{
+			Scope:  scope,
+			Metric: m.name,
+			Old:    m.old,
+			New:    m.new,
+			Change: relativeChange(m.old, m.new),
+			PValue: m.pValue,
+		}
+		worse := m.new > m.old
+		if m.higherIsBetter {
+			worse = m.new < m.old
+		}
+		worse = worse && math.Abs(d.Change) > opts.Tolerance
+		if math.IsNaN(m.pValue) {
+			d.Regression = worse && opts.UntestedTolerance > 0 && math.Abs(d.Change) > opts.UntestedTolerance
+			d.Untested = worse && !d.Regression
+		} else {
+			d.Regression = worse && m.pValue < opts.Alpha
+		}
+		deltas = append(deltas, d)
+	}
+	return deltas
+}
+
+func relativeChange(o, n float64) float64 {
+	if o == 0 {
+		if n == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return (n - o) / o
+}
+
+// welchPValue is the two-sided p-value of the Welch's t-test for the difference of the means.
+// The load tests produce thousands of samples, so the t distribution is approximated by the normal one.
+func welchPValue(o, n Latency) float64 {
+	if o.Count < 2 || n.Count < 2 {
+		return math.NaN()
+	}
+	se := math.Sqrt(o.StdDevMs*o.StdDevMs/float64(o.Count) + n.StdDevMs*n.StdDevMs/float64(n.Count))
+	if se == 0 {
+		if o.MeanMs == n.MeanMs {
+			return 1
+		}
+		return 0
+	}
+	return normalTwoSidedPValue((n.MeanMs - o.MeanMs) / se)
+}
+
+// twoProportionPValue is the two-sided p-value of the two-proportion z-test.
+func twoProportionPValue(x1, n1, x2, n2 int64) float64 {
+	if n1 == 0 || n2 == 0 {
+		return math.NaN()
+	}
+	p := float64(x1+x2) / float64(n1+n2)
+	se := math.Sqrt(p * (1 - p) * (1/float64(n1) + 1/float64(n2)))
+	if se == 0 {
+		return 1
+	}
+	z := (float64(x2)/float64(n2) - float64(x1)/float64(n1)) / se
+	return normalTwoSidedPValue(z)
+}
+
+func normalTwoSidedPValue(z float64) float64 {
+	return math.Erfc(math.Abs(z) / math.Sqrt2)
+}
+
+// PrintComparison prints the deltas as a table.
+func PrintComparison(w io.Writer, deltas []Delta) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SCOPE\tMETRIC\tOLD\tNEW\tCHANGE\tP-VALUE\t")
+	for _, d := range deltas {
+		pValue := "-"
+		if !math.IsNaN(d.PValue) {
+			pValue = fmt.Sprintf("%.4f", d.PValue)
+		}
+		verdict := ""
+		switch {
+		case d.Regression:
+			verdict = "REGRESSION"
+		case d.Untested:
+			verdict = "untested"
+		}
+		fmt.Fprintf(
+			tw, "%s\t%s\t%.3f\t%.3f\t%+.2f%%\t%s\t%s\n",
+			d.Scope, d.Metric, d.Old, d.New, d.Change*100, pValue, verdict,
+		)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, d := range deltas {
+		if d.Untested {
+			_, err := fmt.Fprintln(w, "untested: worse beyond the tolerance, but there is no significance test "+
+				"for the metric, set -untested-tolerance to treat such changes as regressions")
+			return err
+		}
+	}
+	return nil
+}
+
+func HasRegressions(deltas []Delta) bool {
+	for _, d := range deltas {
+		if d.Regression {
+			return true
+		}
+	}
+	return false
+}
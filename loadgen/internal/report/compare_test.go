@@ -0,0 +1,73 @@
+package report
+
+import "testing"
+
+func TestCompare(t *testing.T) {
+	base := Stats{
+		Ops:          100000,
+		Errors:       100,
+		ErrorRate:    0.001,
+		OpsPerSecond: 2000,
+		Latency:      Latency{Count: 100000, MeanMs: 5, StdDevMs: 2, P99Ms: 12},
+	}
+	slower := base
+	slower.OpsPerSecond = 1700
+	slower.Latency.MeanMs = 6
+	slower.Latency.P99Ms = 12.1
+	noisy := base
+	noisy.Latency = Latency{Count: 10, MeanMs: 6, StdDevMs: 4, P99Ms: 12}
+
+	opts := CompareOptions{Tolerance: 0.05, Alpha: 0.05}
+	gated := opts
+	gated.UntestedTolerance = 0.1
+	tests := []struct {
+		name            string
+		newStats        Stats
+		opts            CompareOptions
+		wantRegressions map[string]bool
+		wantUntested    map[string]bool
+	}{
+		{
+			name:            "same",
+			newStats:        base,
+			wantRegressions: map[string]bool{},
+		},
+		{
+			name:            "slower",
+			newStats:        slower,
+			wantRegressions: map[string]bool{"mean_ms": true},
+			// the throughput has no significance test, it may be noise
+			wantUntested: map[string]bool{"ops_per_second": true},
+		},
+		{
+			name:     "slower with untested tolerance",
+			newStats: slower,
+			opts:     gated,
+			wantRegressions: map[string]bool{
+				"ops_per_second": true,
+				"mean_ms":        true,
+			},
+		},
+		{
+			name:            "not significant",
+			newStats:        noisy,
+			wantRegressions: map[string]bool{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.opts == (CompareOptions{}) {
+				tt.opts = opts
+			}
+			deltas := Compare(&Report{Total: base}, &Report{Total: tt.newStats}, tt.opts)
+			for _, d := range deltas {
+				if d.Regression != tt.wantRegressions[d.Metric] {
+					t.Errorf("%s: Regression = %v, want %v (%+v)", d.Metric, d.Regression, tt.wantRegressions[d.Metric], d)
+				}
+				if d.Untested != tt.wantUntested[d.Metric] {
+					t.Errorf("%s: Untested = %v, want %v (%+v)", d.Metric, d.Untested, tt.wantUntested[d.Metric], d)
+				}
+			}
+		})
+	}
+}
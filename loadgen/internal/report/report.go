@@ -0,0 +1,215 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Report is the machine-readable result of a load test run.
+type Report struct {
+	Meta Meta `json:"meta"`
+	// Config is the configuration the run was made with.
+	Config     json.RawMessage  `json:"config,omitempty"`
+	Total      Stats            `json:"total"`
+	Operations map[string]Stats `json:"operations,omitempty"`
+	Stages     []Stats          `json:"stages,omitempty"`
+	Warmup     *Stats           `json:"warmup,omitempty"`
+	Thresholds []Threshold      `json:"thresholds,omitempty"`
+	Keys       *Keys            `json:"keys,omitempty"`
+	Phases     *Phases          `json:"phases,omitempty"`
+}
+
+// Meta describes the environment of the run without relying on a VCS.
+type Meta struct {
+	RunID      string    `json:"run_id"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Hostname   string    `json:"hostname"`
+	GoVersion  string    `json:"go_version"`
+	OS         string    `json:"os"`
+	Arch       string    `json:"arch"`
+	NumCPU     int       `json:"num_cpu"`
+	Args       []string  `json:"args"`
+	// Seed reproduces the sequence of the requests of the run.
+	Seed int64 `json:"seed"`
+	// Interrupted is set if the run was stopped before its planned end and the results are partial.
+	Interrupted bool `json:"interrupted,omitempty"`
+	// Aborted is set if the run was stopped because a threshold had been irrecoverably breached.
+	Aborted bool `json:"aborted,omitempty"`
+	// Agents is the number of the agents of a distributed run the results are merged from.
+	Agents int `json:"agents,omitempty"`
+}
+
+type Stats struct {
+	Name        string  `json:"name"`
+	DurationSec float64 `json:"duration_sec"`
+	Ops         int64   `json:"ops"`
+	Errors      int64   `json:"errors"`
+	// Cancelled requests were still in flight when the run ended, they are not errors.
+	Cancelled    int64   `json:"cancelled,omitempty"`
+	ErrorRate    float64 `json:"error_rate"`
+	OpsPerSecond float64 `json:"ops_per_second"`
+	Scheduled    int64   `json:"scheduled,omitempty"`
+	Dropped      int64   `json:"dropped,omitempty"`
+	// StatusCodes is keyed by the string status code to keep the JSON object keys readable.
+	StatusCodes     map[string]int64 `json:"status_codes,omitempty"`
+	ErrorCategories []ErrorCategory  `json:"error_categories,omitempty"`
+	Latency         Latency          `json:"latency"`
+}
+
+type ErrorCategory struct {
+	Category string    `json:"category"`
+	Count    int64     `json:"count"`
+	First    time.Time `json:"first"`
+	Last     time.Time `json:"last"`
+	Sample   string    `json:"sample"`
+}
+
+// Latency holds the latency statistics in milliseconds.
+type Latency struct {
+	Count    int64   `json:"count"`
+	MinMs    float64 `json:"min_ms"`
+	MeanMs   float64 `json:"mean_ms"`
+	StdDevMs float64 `json:"stddev_ms"`
+	P50Ms    float64 `json:"p50_ms"`
+	P90Ms    float64 `json:"p90_ms"`
+	P99Ms    float64 `json:"p99_ms"`
+	P999Ms   float64 `json:"p99_9_ms"`
+	MaxMs    float64 `json:"max_ms"`
+}
+
+// Phases breaks the request latency down by the connection phases.
+type Phases struct {
+	ReuseRatio  float64 `json:"reuse_ratio"`
+	ReusedConns int64   `json:"reused_conns"`
+	NewConns    int64   `json:"new_conns"`
+	// Latency is keyed by the phase: dns, connect, tls, conn_wait, ttfb, body_read.
+	Latency map[string]Latency `json:"latency"`
+}
+
+// Keys is the realised distribution of the requested keys.
+type Keys struct {
+	Distribution  string  `json:"distribution"`
+	Keys          int     `json:"keys"`
+	Requests      int64   `json:"requests"`
+	Touched       int     `json:"touched"`
+	TopKeyShare   float64 `json:"top_key_share"`
+	Top1PctShare  float64 `json:"top_1pct_share"`
+	Top10PctShare float64 `json:"top_10pct_share"`
+}
+
+type Threshold struct {
+	Threshold string `json:"threshold"`
+	Actual    string `json:"actual"`
+	Passed    bool   `json:"passed"`
+}
+
+func Ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func WriteJSON(path string, r *Report) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create the report file: %w", err)
+	}
+	defer f.Close()
+
+	e := json.NewEncoder(f)
+	e.SetIndent("", "  ")
+	if err := e.Encode(r); err != nil {
+		return fmt.Errorf("failed to write the JSON report: %w", err)
+	}
+	return f.Close()
+}
+
+func ReadJSON(path string) (*Report, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the report file: %w", err)
+	}
+	r := &Report{}
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, fmt.Errorf("failed to parse the report %s: %w", path, err)
+	}
+	return r, nil
+}
+
+var csvHeader = []string{
+	"scope", "name", "duration_sec", "ops", "errors", "error_rate", "ops_per_second", "scheduled", "dropped",
+	"latency_count", "min_ms", "mean_ms", "stddev_ms", "p50_ms", "p90_ms", "p99_ms", "p99_9_ms", "max_ms",
+	"status_codes", "error_categories",
+}
+
+// WriteCSV writes one row for the totals, every operation and every stage.
+func WriteCSV(path string, r *Report) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create the report file: %w", err)
+	}
+	defer f.Close()
+
+	if err := writeCSV(f, r); err != nil {
+		return fmt.Errorf("failed to write the CSV report: %w", err)
+	}
+	return f.Close()
+}
+
+func writeCSV(w io.Writer, r *Report) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	rows := [][]string{csvRow("total", r.Total)}
+	for _, name := range SortedKeys(r.Operations) {
+		rows = append(rows, csvRow("operation", r.Operations[name]))
+	}
+	for _, s := range r.Stages {
+		rows = append(rows, csvRow("stage", s))
+	}
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+func csvRow(scope string, s Stats) []string {
+	f := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	i := func(v int64) string {
+		return strconv.FormatInt(v, 10)
+	}
+	codes := make([]string, 0, len(s.StatusCodes))
+	for _, c := range SortedKeys(s.StatusCodes) {
+		codes = append(codes, c+":"+i(s.StatusCodes[c]))
+	}
+	categories := make([]string, 0, len(s.ErrorCategories))
+	for _, c := range s.ErrorCategories {
+		categories = append(categories, c.Category+":"+i(c.Count))
+	}
+	l := s.Latency
+	return []string{
+		scope, s.Name, f(s.DurationSec), i(s.Ops), i(s.Errors), f(s.ErrorRate), f(s.OpsPerSecond),
+		i(s.Scheduled), i(s.Dropped),
+		i(l.Count), f(l.MinMs), f(l.MeanMs), f(l.StdDevMs), f(l.P50Ms), f(l.P90Ms), f(l.P99Ms), f(l.P999Ms), f(l.MaxMs),
+		strings.Join(codes, ";"), strings.Join(categories, ";"),
+	}
+}
+
+// SortedKeys returns the keys of the map in the ascending order.
+func SortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
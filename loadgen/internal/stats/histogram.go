@@ -0,0 +1,356 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// Histogram is a log-linear (HDR-style) latency histogram.
+// Values are recorded with a microsecond resolution and a relative error below 1/64.
+// Buckets are allocated lazily, so recording into a histogram that has already seen
+// a value of the same magnitude does not allocate.
+// A Histogram is not safe for concurrent use: every worker should own its histogram,
+// and the results should be combined with Merge.
+type Histogram struct {
+	counts []int64
+	count  int64
+	sum    float64
+	sumSq  float64
+	min    int64
+	max    int64
+}
+
+const (
+	subBucketBits  = 7
+	subBucketCount = 1 << subBucketBits
+	subBucketHalf  = subBucketCount / 2
+
+	// maxValue is the highest trackable value (in microseconds), larger values are clamped.
+	maxValue = int64(time.Hour / time.Microsecond)
+)
+
+func NewHistogram() *Histogram {
+	return &Histogram{}
+}
+
+func bucketIndex(v int64) int {
+	if v < subBucketCount {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - subBucketBits
+	return shift*subBucketHalf + int(v>>shift)
+}
+
+// bucketUpperBound returns the highest value which falls into the bucket.
+func bucketUpperBound(idx int) int64 {
+	if idx < subBucketCount {
+		return int64(idx)
+	}
+	shift := idx/subBucketHalf - 1
+	sub := int64(idx - shift*subBucketHalf)
+	return (sub+1)<<shift - 1
+}
+
+func (h *Histogram) Record(d time.Duration) {
+	v := int64(d / time.Microsecond)
+	if v < 0 {
+		v = 0
+	}
+	if v > maxValue {
+		v = maxValue
+	}
+	idx := bucketIndex(v)
+	if idx >= len(h.counts) {
+		h.grow(idx + 1)
+	}
+	h.counts[idx]++
+
+	if h.count == 0 || v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+	h.count++
+	fd := float64(d)
+	h.sum += fd
+	h.sumSq += fd * fd
+}
+
+func (h *Histogram) grow(n int) {
+	// growing straight to the next magnitude keeps the number of reallocations small
+	n = (n/subBucketHalf + 1) * subBucketHalf
+	c := make([]int64, n)
+	copy(c, h.counts)
+	h.counts = c
+}
+
+// Merge adds all the values recorded by o to h.
+func (h *Histogram) Merge(o *Histogram) {
+	if o == nil || o.count == 0 {
+		return
+	}
+	if len(o.counts) > len(h.counts) {
+		h.grow(len(o.counts))
+	}
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+	if h.count == 0 || o.min < h.min {
+		h.min = o.min
+	}
+	if o.max > h.max {
+		h.max = o.max
+	}
+	h.count += o.count
+	h.sum += o.sum
+	h.sumSq += o.sumSq
+}
+
+func (h *Histogram) Count() int64 {
+	return h.count
+}
+
+func (h *Histogram) Min() time.Duration {
+	return time.Duration(h.min) * time.Microsecond
+}
+
+func (h *Histogram) Max() time.Duration {
+	return time.Duration(h.max) * time.Microsecond
+}
+
+func (h *Histogram) Mean() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	return time.Duration(h.sum / float64(h.count)).Round(time.Microsecond)
+}
+
+func (h *Histogram) StdDev() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	mean := h.sum / float64(h.count)
+	variance := h.sumSq/float64(h.count) - mean*mean
+	if variance < 0 {
+		variance = 0
+	}
+	return time.Duration(math.Sqrt(variance)).Round(time.Microsecond)
+}
+
+// Quantile returns the value below which the q fraction (0 <= q <= 1) of the recorded values fall.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	if q <= 0 {
+		return h.Min()
+	}
+	rank := int64(math.Ceil(q * float64(h.count)))
+	if rank > h.count {
+		rank = h.count
+	}
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			v := bucketUpperBound(i)
+			if v > h.max {
+				v = h.max
+			}
+			if v < h.min {
+				v = h.min
+			}
+			return time.Duration(v) * time.Microsecond
+		}
+	}
+	return h.Max()
+}
+
+// CountAbove returns the number of the recorded values which are certainly greater than d,
+// i.e. the whole bucket they fall into is above d.
+func (h *Histogram) CountAbove(d time.Duration) int64 {
+	v := int64(d / time.Microsecond)
+	var n int64
+	for i, c := range h.counts {
+		if bucketLowerBound(i) > v {
+			n += c
+		}
+	}
+	return n
+}
+
+// CountAtMost returns the number of the recorded values which are certainly not greater than d,
+// i.e. the whole bucket they fall into is at or below d.
+func (h *Histogram) CountAtMost(d time.Duration) int64 {
+	v := int64(d / time.Microsecond)
+	var n int64
+	for i, c := range h.counts {
+		if bucketUpperBound(i) <= v {
+			n += c
+		}
+	}
+	return n
+}
+
+type Summary struct {
+	Count  int64
+	Min    time.Duration
+	Mean   time.Duration
+	StdDev time.Duration
+	P50    time.Duration
+	P90    time.Duration
+	P99    time.Duration
+	P999   time.Duration
+	Max    time.Duration
+}
+
+func (h *Histogram) Summary() Summary {
+	return Summary{
+		Count:  h.count,
+		Min:    h.Min(),
+		Mean:   h.Mean(),
+		StdDev: h.StdDev(),
+		P50:    h.Quantile(0.5),
+		P90:    h.Quantile(0.9),
+		P99:    h.Quantile(0.99),
+		P999:   h.Quantile(0.999),
+		Max:    h.Max(),
+	}
+}
+
+// AtomicHistogram is a fixed-size histogram which is safe for concurrent recording.
+// It does not track the sum of the values, and is meant to be periodically
+// read with Snapshot, e.g. to display the live statistics.
+type AtomicHistogram struct {
+	counts []atomic.Int64
+}
+
+func NewAtomicHistogram() *AtomicHistogram {
+	return &AtomicHistogram{
+		counts: make([]atomic.Int64, bucketIndex(maxValue)+1),
+	}
+}
+
+func (h *AtomicHistogram) Record(d time.Duration) {
+	v := int64(d / time.Microsecond)
+	if v < 0 {
+		v = 0
+	}
+	if v > maxValue {
+		v = maxValue
+	}
+	h.counts[bucketIndex(v)].Add(1)
+}
+
+// Snapshot returns the cumulative histogram of the values recorded so far.
+// Its min, max and quantiles are precise up to the bucket width, its mean is unknown.
+func (h *AtomicHistogram) Snapshot() *Histogram {
+	s := &Histogram{
+		counts: make([]int64, len(h.counts)),
+	}
+	for i := range h.counts {
+		s.counts[i] = h.counts[i].Load()
+	}
+	s.updateBounds()
+	return s
+}
+
+// Sub returns the histogram of the values recorded since the prev snapshot of the same AtomicHistogram.
+func (h *Histogram) Sub(prev *Histogram) *Histogram {
+	d := &Histogram{
+		counts: make([]int64, len(h.counts)),
+	}
+	copy(d.counts, h.counts)
+	if prev != nil {
+		for i := range prev.counts {
+			if i < len(d.counts) {
+				d.counts[i] -= prev.counts[i]
+			}
+		}
+	}
+	d.updateBounds()
+	return d
+}
+
+// updateBounds derives the count, min and max from the buckets.
+func (h *Histogram) updateBounds() {
+	h.count, h.min, h.max = 0, 0, 0
+	for i, c := range h.counts {
+		if c == 0 {
+			continue
+		}
+		if h.count == 0 {
+			h.min = bucketLowerBound(i)
+		}
+		h.count += c
+		h.max = bucketUpperBound(i)
+	}
+}
+
+func bucketLowerBound(idx int) int64 {
+	if idx < subBucketCount {
+		return int64(idx)
+	}
+	shift := idx/subBucketHalf - 1
+	sub := int64(idx - shift*subBucketHalf)
+	return sub << shift
+}
+
+// histogramJSON is the wire format of a Histogram, e.g. for merging the results of several processes.
+// Only the non-empty buckets are listed as index and count pairs.
+type histogramJSON struct {
+	Buckets [][2]int64 `json:"buckets"`
+	Count   int64      `json:"count"`
+	Sum     float64    `json:"sum"`
+	SumSq   float64    `json:"sum_sq"`
+	Min     int64      `json:"min"`
+	Max     int64      `json:"max"`
+}
+
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	j := histogramJSON{
+		Buckets: [][2]int64{},
+		Count:   h.count,
+		Sum:     h.sum,
+		SumSq:   h.sumSq,
+		Min:     h.min,
+		Max:     h.max,
+	}
+	for i, c := range h.counts {
+		if c != 0 {
+			j.Buckets = append(j.Buckets, [2]int64{int64(i), c})
+		}
+	}
+	return json.Marshal(j)
+}
+
+func (h *Histogram) UnmarshalJSON(b []byte) error {
+	var j histogramJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	*h = Histogram{
+		count: j.Count,
+		sum:   j.Sum,
+		sumSq: j.SumSq,
+		min:   j.Min,
+		max:   j.Max,
+	}
+	limit := int64(bucketIndex(maxValue))
+	for _, bc := range j.Buckets {
+		idx, c := bc[0], bc[1]
+		if idx < 0 || idx > limit || c < 0 {
+			return fmt.Errorf("invalid histogram bucket %d with count %d", idx, c)
+		}
+		if int(idx) >= len(h.counts) {
+			h.grow(int(idx) + 1)
+		}
+		h.counts[idx] += c
+	}
+	return nil
+}
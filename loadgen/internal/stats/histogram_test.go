@@ -0,0 +1,94 @@
+package stats
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestHistogramQuantiles(t *testing.T) {
+	h := NewHistogram()
+	for i := 1; i <= 10000; i++ {
+		h.Record(time.Duration(i) * time.Microsecond)
+	}
+
+	tests := []struct {
+		q    float64
+		want time.Duration
+	}{
+		{q: 0.5, want: 5000 * time.Microsecond},
+		{q: 0.9, want: 9000 * time.Microsecond},
+		{q: 0.99, want: 9900 * time.Microsecond},
+		{q: 1, want: 10000 * time.Microsecond},
+	}
+	for _, tt := range tests {
+		got := h.Quantile(tt.q)
+		if diff := got - tt.want; diff < 0 || float64(diff) > float64(tt.want)/64 {
+			t.Errorf("Quantile(%v) = %v, want %v within 1/64", tt.q, got, tt.want)
+		}
+	}
+	if h.Min() != time.Microsecond || h.Max() != 10000*time.Microsecond {
+		t.Errorf("unexpected min/max: %v/%v", h.Min(), h.Max())
+	}
+	if got := h.Mean(); got != 5001*time.Microsecond {
+		t.Errorf("Mean() = %v, want 5.001ms", got)
+	}
+	// the bucket 9000 falls into is 128µs wide, its values are not certainly above
+	if got := h.CountAbove(9000 * time.Microsecond); got > 1000 || got < 1000-128 {
+		t.Errorf("CountAbove(9ms) = %d, want about 1000", got)
+	}
+	if got := h.CountAtMost(9000 * time.Microsecond); got > 9000 || got < 9000-128 {
+		t.Errorf("CountAtMost(9ms) = %d, want about 9000", got)
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	a, b, all := NewHistogram(), NewHistogram(), NewHistogram()
+	for i := 0; i < 1000; i++ {
+		d := time.Duration(i*i) * time.Microsecond
+		all.Record(d)
+		if i%2 == 0 {
+			a.Record(d)
+		} else {
+			b.Record(d)
+		}
+	}
+	a.Merge(b)
+
+	if a.Summary() != all.Summary() {
+		t.Errorf("merged summary %+v differs from %+v", a.Summary(), all.Summary())
+	}
+}
+
+func TestHistogramJSON(t *testing.T) {
+	h := NewHistogram()
+	for i := 0; i < 1000; i++ {
+		h.Record(time.Duration(i*i) * time.Microsecond)
+	}
+	b, err := json.Marshal(h)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+	var got Histogram
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if got.Summary() != h.Summary() {
+		t.Errorf("decoded summary %+v differs from %+v", got.Summary(), h.Summary())
+	}
+
+	if err := json.Unmarshal([]byte(`{"buckets":[[-1,1]]}`), &got); err == nil {
+		t.Errorf("expected an error for an invalid bucket")
+	}
+}
+
+func TestHistogramRecordDoesNotAllocate(t *testing.T) {
+	h := NewHistogram()
+	h.Record(time.Second)
+	allocs := testing.AllocsPerRun(100, func() {
+		h.Record(time.Millisecond)
+	})
+	if allocs != 0 {
+		t.Errorf("Record allocates %v times per call", allocs)
+	}
+}